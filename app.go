@@ -1,13 +1,17 @@
 package kratospkg
 
 import (
+	"context"
+
 	"github.com/go-kratos/kratos/v2"
 	"github.com/go-kratos/kratos/v2/transport"
 	"github.com/yearm/kratos-pkg/env"
+	"github.com/yearm/kratos-pkg/xgrpc"
 	_ "go.uber.org/automaxprocs"
 )
 
-// NewApp creates a kratos application.
+// NewApp creates a kratos application. The gRPC health service reports NOT_SERVING once it starts stopping,
+// and the cached gRPC client connections are closed after it stops.
 func NewApp(ss []transport.Server, opts []kratos.Option) *kratos.App {
 	options := []kratos.Option{
 		kratos.ID(env.GetServiceID()),
@@ -15,6 +19,13 @@ func NewApp(ss []transport.Server, opts []kratos.Option) *kratos.App {
 		kratos.Version(env.GetServiceVersion()),
 		kratos.Metadata(env.GetServiceMetadata()),
 		kratos.Server(ss...),
+		kratos.BeforeStop(func(context.Context) error {
+			xgrpc.ShutdownHealth()
+			return nil
+		}),
+		kratos.AfterStop(func(context.Context) error {
+			return xgrpc.CloseAll()
+		}),
 	}
 	options = append(options, opts...)
 	return kratos.New(options...)
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/go-kratos/kratos/v2/config"
+	"github.com/go-kratos/kratos/v2/log"
 	"github.com/yearm/kratos-pkg/errors"
 )
 
@@ -21,21 +23,187 @@ func SetClientGRPCConfigKey(key string) {
 }
 
 // ClientGRPCConfig grpc client config.
+// The endpoint is either a literal address or "discovery:///<service>" resolved through the service discovery.
+// The timeouts of the operations are set in the methods, e.g.
+//
+//	timeout: 2
+//	methods:
+//	  /helloworld.Greeter/SayHello:
+//	    timeout: 500ms
 type ClientGRPCConfig struct {
 	Endpoint string `json:"endpoint"`
-	Timeout  int    `json:"timeout"`
-	TLS      bool   `json:"tls"`
+	// Timeout timeout of every attempt of the operations in seconds, see MethodConfig.Timeout.
+	Timeout int        `json:"timeout"`
+	TLS     *TLSConfig `json:"tls"`
+	// Balancer load balancing algorithm of the discovery endpoint: p2c, wrr or random,
+	// the global kratos selector is used if empty.
+	Balancer string `json:"balancer"`
+	// NodeFilter selects the instances of the discovery endpoint.
+	NodeFilter *NodeFilterConfig `json:"nodeFilter"`
+	// Warmup connects eagerly when the connection is created, failing if it is not ready within ConnectTimeout.
+	Warmup bool `json:"warmup"`
+	// ConnectTimeout timeout of the warm-up and of watching the discovery endpoint in seconds, 5 seconds by default.
+	ConnectTimeout int `json:"connectTimeout"`
+	// Retry retry policy of the idempotent operations.
+	Retry *RetryConfig `json:"retry"`
+	// Methods per-operation config keyed by the operation, e.g. "/helloworld.Greeter/SayHello".
+	Methods map[string]*MethodConfig `json:"methods"`
+	// Limit limits of the requests to the downstream.
+	Limit *LimitConfig `json:"limit"`
+	// Breaker thresholds of the circuit breaker installed by the connections of xgrpc, the defaults of
+	// xgrpc.ClientBreaker apply if it is not set. An xgrpc.ClientBreaker among the middlewares of the client
+	// takes its place.
+	Breaker *BreakerConfig `json:"breaker"`
+
+	// name of the config, see GetClientGRPCConfig.
+	name string
+}
+
+// MethodConfig per-operation config of the client.
+type MethodConfig struct {
+	// Timeout timeout of the operation in milliseconds or as a duration string, overriding the Timeout of the client.
+	// Every attempt has its own timeout, i.e. the retries and the hedged attempts, the deadline of the caller
+	// bounds them all.
+	Timeout Duration `json:"timeout"`
+	// Idempotent marks the operation safe to retry.
+	Idempotent bool `json:"idempotent"`
+	// Retry overrides the retry policy of the client.
+	Retry *RetryConfig `json:"retry"`
+	// Hedge marks the operation safe to hedge and configures the hedging policy.
+	Hedge *HedgeConfig `json:"hedge"`
+	// Limit limits of the operation, they apply instead of the limits of the client.
+	Limit *LimitConfig `json:"limit"`
+}
+
+// LimitConfig client-side limits of the requests, the unset limits are unlimited.
+type LimitConfig struct {
+	// MaxConcurrency maximum number of in-flight requests.
+	MaxConcurrency int64 `json:"maxConcurrency"`
+	// Rate requests per second of the token bucket.
+	Rate float64 `json:"rate"`
+	// Burst capacity of the token bucket, the rate rounded up by default.
+	Burst int `json:"burst"`
+	// MaxWait how long a request waits for the limits before it is rejected, 0 rejects it at once.
+	MaxWait Duration `json:"maxWait"`
+	// PerOperation applies the limits to every operation separately instead of the whole downstream.
+	PerOperation bool `json:"perOperation"`
+}
+
+func (c *LimitConfig) isValid() bool {
+	return c == nil || (c.MaxConcurrency >= 0 && c.Rate >= 0 && c.Burst >= 0 && c.MaxWait >= 0)
+}
+
+// HedgeConfig hedging policy of an operation: while no attempt has succeeded, another attempt is sent to
+// a different instance after the delay, and the first success wins.
+type HedgeConfig struct {
+	// MaxAttempts maximum number of attempts including the first one, 2 by default.
+	MaxAttempts int `json:"maxAttempts"`
+	// Delay delay before sending the next attempt, it is also used until the percentile is known.
+	Delay Duration `json:"delay"`
+	// Percentile uses the latency percentile of the recent successful attempts as the delay, e.g. 0.95.
+	Percentile float64 `json:"percentile"`
+}
+
+// RetryConfig retry policy of the client, the backoff grows exponentially with jitter.
+type RetryConfig struct {
+	// MaxAttempts maximum number of attempts including the first one, 3 by default.
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff backoff before the first retry, 50ms by default.
+	InitialBackoff Duration `json:"initialBackoff"`
+	// MaxBackoff upper bound of the backoff, 1s by default.
+	MaxBackoff Duration `json:"maxBackoff"`
+	// Multiplier growth factor of the backoff, 2 by default.
+	Multiplier float64 `json:"multiplier"`
+	// Jitter randomizes the backoff by up to this fraction, 0.2 by default.
+	Jitter float64 `json:"jitter"`
+	// RetryableCodes business codes to retry, the retryable codes of ecodes by default.
+	RetryableCodes []uint32 `json:"retryableCodes"`
+	// RetryableGRPCCodes gRPC status codes to retry regardless of the business code, e.g. "UNAVAILABLE".
+	RetryableGRPCCodes []string `json:"retryableGRPCCodes"`
+	// Budget token-bucket retry budget of the client.
+	Budget *RetryBudgetConfig `json:"budget"`
+}
+
+// RetryBudgetConfig token-bucket retry budget: every retryable failure takes a token and every success
+// returns TokenRatio tokens, retries are allowed while more than half of MaxTokens remain.
+type RetryBudgetConfig struct {
+	// MaxTokens capacity of the bucket, 10 by default.
+	MaxTokens float64 `json:"maxTokens"`
+	// TokenRatio tokens returned by a success, 0.1 by default.
+	TokenRatio float64 `json:"tokenRatio"`
+}
+
+// BreakerConfig circuit breaker config: requests are rejected with a growing probability once the success ratio
+// in the window drops below Success and at least Request requests were made.
+type BreakerConfig struct {
+	// Success success ratio threshold, 0.6 by default.
+	Success float64 `json:"success"`
+	// Request minimum number of requests in the window before the breaker trips, 100 by default.
+	Request int64 `json:"request"`
+	// Window statistical window, 3s by default.
+	Window Duration `json:"window"`
+	// Bucket number of buckets of the window, 10 by default.
+	Bucket int `json:"bucket"`
+	// PerEndpoint keys the breakers by the instance as well as the operation.
+	PerEndpoint bool `json:"perEndpoint"`
+	// NodeMetrics labels the metrics of the breakers keyed by the instance with its address.
+	NodeMetrics bool `json:"nodeMetrics"`
+}
+
+// Name returns the name of the config, it is empty if the config is not loaded by GetClientGRPCConfig.
+func (c *ClientGRPCConfig) Name() string {
+	return c.name
+}
+
+// Method returns the config of the operation, it is nil if the operation is not configured.
+func (c *ClientGRPCConfig) Method(operation string) *MethodConfig {
+	return c.Methods[operation]
+}
+
+// NodeFilterConfig selects the service instances by version and metadata.
+type NodeFilterConfig struct {
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 func (c *ClientGRPCConfig) isValid() bool {
-	return c.Endpoint != "" && c.Timeout >= 0
+	switch c.Balancer {
+	case "", "p2c", "wrr", "random":
+	default:
+		return false
+	}
+	for _, m := range c.Methods {
+		if m != nil && m.Hedge != nil && (m.Hedge.Percentile < 0 || m.Hedge.Percentile >= 1 || m.Hedge.Delay < 0) {
+			return false
+		}
+		if m != nil && (m.Timeout < 0 || !m.Limit.isValid()) {
+			return false
+		}
+	}
+	if !c.Limit.isValid() {
+		return false
+	}
+	if b := c.Breaker; b != nil && (b.Success < 0 || b.Success > 1 || b.Request < 0 || b.Window < 0 || b.Bucket < 0) {
+		return false
+	}
+	return c.Endpoint != "" && c.Timeout >= 0 && c.ConnectTimeout >= 0 && c.TLS.isValid()
 }
 
 // GetClientGRPCConfig retrieves grpc client configuration from global settings.
 func GetClientGRPCConfig(name string) (*ClientGRPCConfig, error) {
 	key := fmt.Sprintf("%s.%s", defaultClientGRPCConfigKey, name)
+	config, err := scanClientGRPCConfig(key, Value(key))
+	if err != nil {
+		return nil, err
+	}
+	config.name = name
+	return config, nil
+}
+
+// scanClientGRPCConfig scans and validates the grpc client configuration.
+func scanClientGRPCConfig(key string, v config.Value) (*ClientGRPCConfig, error) {
 	var config *ClientGRPCConfig
-	err := Value(key).Scan(&config)
+	err := v.Scan(&config)
 	if err != nil {
 		return nil, errors.Wrapf(err, "config.Scan[%v] faild", key)
 	}
@@ -44,3 +212,41 @@ func GetClientGRPCConfig(name string) (*ClientGRPCConfig, error) {
 	}
 	return config, nil
 }
+
+var (
+	// clientGRPCConfigObservers observers of the grpc client configurations keyed by name.
+	clientGRPCConfigObservers   = make(map[string][]func(*ClientGRPCConfig))
+	clientGRPCConfigObserversMu sync.Mutex
+)
+
+// WatchClientGRPCConfig calls fn with the new grpc client configuration whenever it changes,
+// invalid configurations are ignored.
+func WatchClientGRPCConfig(name string, fn func(*ClientGRPCConfig)) error {
+	clientGRPCConfigObserversMu.Lock()
+	defer clientGRPCConfigObserversMu.Unlock()
+
+	key := fmt.Sprintf("%s.%s", defaultClientGRPCConfigKey, name)
+	if _, ok := clientGRPCConfigObservers[name]; !ok {
+		// kratos keeps one observer per key, so the observers of a name share it.
+		err := Watch(key, func(key string, v config.Value) {
+			c, err := scanClientGRPCConfig(key, v)
+			if err != nil {
+				log.Errorf("watch client grpc config failed: %v", err)
+				return
+			}
+			c.name = name
+
+			clientGRPCConfigObserversMu.Lock()
+			observers := clientGRPCConfigObservers[name]
+			clientGRPCConfigObserversMu.Unlock()
+			for _, observer := range observers {
+				observer(c)
+			}
+		})
+		if err != nil {
+			return errors.Wrapf(err, "config.Watch[%v] failed", key)
+		}
+	}
+	clientGRPCConfigObservers[name] = append(clientGRPCConfigObservers[name], fn)
+	return nil
+}
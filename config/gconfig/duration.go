@@ -0,0 +1,71 @@
+package gconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Duration a time.Duration configured in milliseconds or as a duration string, e.g. 200 or "200ms".
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler, it accepts a number of milliseconds or a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDuration(data, time.Millisecond)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, the duration is marshaled as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Duration returns the time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// Seconds a time.Duration configured in seconds or as a duration string, e.g. 3 or "500ms",
+// for the timeouts configured in seconds before they accepted duration strings.
+type Seconds time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler, it accepts a number of seconds or a duration string.
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalDuration(data, time.Second)
+	if err != nil {
+		return err
+	}
+	*s = Seconds(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, the duration is marshaled as a duration string.
+func (s Seconds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(s).String())
+}
+
+// Duration returns the time.Duration.
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(s)
+}
+
+// unmarshalDuration parses a duration string or a number in unit.
+func unmarshalDuration(data []byte, unit time.Duration) (time.Duration, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return 0, err
+		}
+		return time.ParseDuration(s)
+	}
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return 0, err
+	}
+	return time.Duration(n * float64(unit)), nil
+}
@@ -24,10 +24,56 @@ type ServerGRPCConfig struct {
 	Host                        string `json:"host"`
 	Port                        int    `json:"port"`
 	EnableHandlingTimeHistogram bool   `json:"enableHandlingTimeHistogram"`
+	// TLS serves TLS, the certificate and key are required if it is enabled.
+	TLS *TLSConfig `json:"tls"`
+	// Timeout default timeout of the requests in seconds or as a duration string,
+	// 0 leaves the timeout to the deadline of the client.
+	Timeout Seconds `json:"timeout"`
+	// MaxRecvMsgSize and MaxSendMsgSize maximum message sizes in bytes, 4MB and unlimited by default.
+	MaxRecvMsgSize int `json:"maxRecvMsgSize"`
+	MaxSendMsgSize int `json:"maxSendMsgSize"`
+	// MaxConcurrentStreams maximum number of concurrent streams of each connection, unlimited by default.
+	MaxConcurrentStreams uint32 `json:"maxConcurrentStreams"`
+	// Keepalive keepalive parameters and enforcement policy.
+	Keepalive *ServerKeepaliveConfig `json:"keepalive"`
+	// Reflection registers the server reflection service, it is enabled by default if the mode is set and is not production.
+	Reflection *bool `json:"reflection"`
+	// Health registers the grpc.health.v1 health service, it is enabled by default.
+	Health *bool `json:"health"`
+	// StreamMessageLog logs every message of the streaming RPCs at debug level.
+	StreamMessageLog bool `json:"streamMessageLog"`
+}
+
+// ServerKeepaliveConfig grpc server keepalive config, the unset values use the grpc defaults.
+type ServerKeepaliveConfig struct {
+	// MaxConnectionIdle closes the connections idle for this duration.
+	MaxConnectionIdle Duration `json:"maxConnectionIdle"`
+	// MaxConnectionAge closes the connections older than this duration, after MaxConnectionAgeGrace
+	// for the pending requests.
+	MaxConnectionAge      Duration `json:"maxConnectionAge"`
+	MaxConnectionAgeGrace Duration `json:"maxConnectionAgeGrace"`
+	// Time pings the clients idle for this duration, and Timeout closes the connection if the ping is not acked.
+	Time    Duration `json:"time"`
+	Timeout Duration `json:"timeout"`
+	// MinTime minimum interval of the client pings, the connections of the clients pinging more often are closed.
+	MinTime Duration `json:"minTime"`
+	// PermitWithoutStream allows the client pings without active streams.
+	PermitWithoutStream bool `json:"permitWithoutStream"`
+}
+
+func (c *ServerKeepaliveConfig) isValid() bool {
+	return c == nil || (c.MaxConnectionIdle >= 0 && c.MaxConnectionAge >= 0 && c.MaxConnectionAgeGrace >= 0 &&
+		c.Time >= 0 && c.Timeout >= 0 && c.MinTime >= 0)
 }
 
 func (s *ServerGRPCConfig) isValid() bool {
-	return s.Host != "" && s.Port != 0
+	if s.TLS.Enabled() && (s.TLS.CertFile == "" || s.TLS.KeyFile == "") {
+		return false
+	}
+	if s.Timeout < 0 || s.MaxRecvMsgSize < 0 || s.MaxSendMsgSize < 0 || !s.Keepalive.isValid() {
+		return false
+	}
+	return s.Host != "" && s.Port != 0 && s.TLS.isValid()
 }
 
 // GetServerGRPCConfig retrieves grpc server configuration from global settings.
@@ -0,0 +1,58 @@
+package gconfig
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// TLSConfig TLS config of the gRPC clients and servers. A boolean value is accepted for compatibility,
+// e.g. "tls": true enables TLS verified by the system roots.
+type TLSConfig struct {
+	// Enable enables TLS, it defaults to true if the TLS config is an object.
+	Enable bool `json:"enable"`
+	// CAFile PEM CA bundle verifying the peer: the server for clients (system roots if empty),
+	// the client certificates for servers (mTLS, client certificates are not required if empty).
+	CAFile string `json:"caFile"`
+	// CertFile and KeyFile PEM certificate and key: the client certificate of mTLS for clients,
+	// the required server certificate for servers.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ServerName overrides the server name verified by clients.
+	ServerName string `json:"serverName"`
+	// MinVersion minimum TLS version: "1.0", "1.1", "1.2" or "1.3", 1.2 by default.
+	MinVersion string `json:"minVersion"`
+	// ReloadInterval interval in seconds of checking the files for changes, 0 disables the hot reload.
+	ReloadInterval int `json:"reloadInterval"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it accepts a boolean or an object.
+func (c *TLSConfig) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] != '{' {
+		return json.Unmarshal(data, &c.Enable)
+	}
+	type plain TLSConfig
+	p := plain{Enable: true}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*c = TLSConfig(p)
+	return nil
+}
+
+// Enabled reports whether TLS is enabled.
+func (c *TLSConfig) Enabled() bool {
+	return c != nil && c.Enable
+}
+
+func (c *TLSConfig) isValid() bool {
+	if !c.Enabled() {
+		return true
+	}
+	switch c.MinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return false
+	}
+	return (c.CertFile == "") == (c.KeyFile == "") && c.ReloadInterval >= 0
+}
@@ -2,9 +2,12 @@ package ecodes
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/samber/lo"
 	"google.golang.org/grpc/codes"
 )
 
@@ -46,29 +49,70 @@ func (c Code) Is(code Code) bool {
 	return c == code
 }
 
+// Severity define the alerting severity of the error code.
+type Severity uint8
+
+const (
+	// SeverityNone the error code does not trigger alerts.
+	SeverityNone Severity = iota
+
+	SeverityInfo
+
+	SeverityWarning
+
+	SeverityCritical
+)
+
+// String returns the lowercase name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityNone:
+		return "none"
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return ""
+}
+
 // CodeDetail define the detailed information structure of the error code.
 type CodeDetail struct {
+	// Message supports named placeholders such as "order {orderId} not found",
+	// which are rendered with the arguments passed to Code.Message.
 	Message string
+	// Reason UPPER_SNAKE_CASE identifier of the error code, e.g. carried in google.rpc.ErrorInfo.
+	Reason string
+	// Level default log level of the error code, nil means log.LevelError.
+	Level *log.Level
+	// Retryable whether the failed request is safe to retry.
+	Retryable bool
+	// Severity alerting severity of the error code.
+	Severity Severity
+	// GRPCCode gRPC status code of the registered error code, codes.OK means codes.Unknown.
+	GRPCCode codes.Code
 	// LocalizeConfig: reserved field for international multilingual support.
 	// LocalizeConfig *i18n.LocalizeConfig
 }
 
 // codeMap global error code registry.
 var codeMap = map[Code]CodeDetail{
-	OK:                  {Message: "成功"},
-	Canceled:            {Message: "操作已取消"},
-	UnknownError:        {Message: "未知错误"},
-	NotImplemented:      {Message: "此接口未实现"},
-	ServiceUnavailable:  {Message: "服务暂时不可用"},
-	InternalServerError: {Message: "服务器内部错误"},
-	TooManyRequests:     {Message: "请求过于频繁"},
-	RequestTimeout:      {Message: "请求超时"},
-	BadRequest:          {Message: "错误请求"},
-	Conflict:            {Message: "资源冲突"},
-	InvalidArgument:     {Message: "无效的参数"},
-	NotFound:            {Message: "资源不存在"},
-	AccessDenied:        {Message: "拒绝访问"},
-	Unauthorized:        {Message: "未经授权"},
+	OK:                  {Message: "成功", Reason: "OK", Level: lo.ToPtr(log.LevelInfo)},
+	Canceled:            {Message: "操作已取消", Reason: "CANCELED", Level: lo.ToPtr(log.LevelWarn)},
+	UnknownError:        {Message: "未知错误", Reason: "UNKNOWN_ERROR", Severity: SeverityWarning},
+	NotImplemented:      {Message: "此接口未实现", Reason: "NOT_IMPLEMENTED"},
+	ServiceUnavailable:  {Message: "服务暂时不可用", Reason: "SERVICE_UNAVAILABLE", Retryable: true, Severity: SeverityCritical},
+	InternalServerError: {Message: "服务器内部错误", Reason: "INTERNAL_SERVER_ERROR", Severity: SeverityCritical},
+	TooManyRequests:     {Message: "请求过于频繁", Reason: "TOO_MANY_REQUESTS", Level: lo.ToPtr(log.LevelWarn), Retryable: true, Severity: SeverityWarning},
+	RequestTimeout:      {Message: "请求超时", Reason: "REQUEST_TIMEOUT", Retryable: true, Severity: SeverityWarning},
+	BadRequest:          {Message: "错误请求", Reason: "BAD_REQUEST", Level: lo.ToPtr(log.LevelWarn)},
+	Conflict:            {Message: "资源冲突", Reason: "CONFLICT", Level: lo.ToPtr(log.LevelWarn)},
+	InvalidArgument:     {Message: "无效的参数", Reason: "INVALID_ARGUMENT", Level: lo.ToPtr(log.LevelWarn)},
+	NotFound:            {Message: "资源不存在", Reason: "NOT_FOUND", Level: lo.ToPtr(log.LevelWarn)},
+	AccessDenied:        {Message: "拒绝访问", Reason: "ACCESS_DENIED", Level: lo.ToPtr(log.LevelWarn)},
+	Unauthorized:        {Message: "未经授权", Reason: "UNAUTHORIZED", Level: lo.ToPtr(log.LevelWarn)},
 }
 
 var mu sync.Mutex
@@ -96,6 +140,129 @@ func (c Code) Message(ctx context.Context) string {
 	return cd.Message
 }
 
+// MessageWith returns the message of the error code with the named placeholders rendered by args.
+func (c Code) MessageWith(ctx context.Context, args map[string]any) string {
+	return FormatMessage(c.Message(ctx), args)
+}
+
+// Reason returns the reason of the error code, codes registered without a reason use "ERROR_CODE_<code>".
+func (c Code) Reason() string {
+	if cd, ok := codeMap[c]; ok && cd.Reason != "" {
+		return cd.Reason
+	}
+	return fmt.Sprintf("ERROR_CODE_%d", c)
+}
+
+// FromReason looks up the error code by its reason, e.g. the reason of a kratos error or google.rpc.ErrorInfo.
+func FromReason(reason string) (Code, bool) {
+	if reason == "" {
+		return 0, false
+	}
+	for code, cd := range codeMap {
+		if cd.Reason == reason {
+			return code, true
+		}
+	}
+	var code Code
+	if _, err := fmt.Sscanf(reason, "ERROR_CODE_%d", &code); err == nil {
+		if _, ok := codeMap[code]; ok {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// Level returns the default log level of the error code, unregistered codes are logged at error level.
+func (c Code) Level() log.Level {
+	cd, ok := codeMap[c]
+	if !ok || cd.Level == nil {
+		return log.LevelError
+	}
+	return *cd.Level
+}
+
+// Retryable reports whether the failed request with the error code is safe to retry.
+func (c Code) Retryable() bool {
+	return codeMap[c].Retryable
+}
+
+// Severity returns the alerting severity of the error code.
+func (c Code) Severity() Severity {
+	return codeMap[c].Severity
+}
+
+// FormatMessage replaces the named placeholders like {orderId} in message with the corresponding args,
+// placeholders without a matching argument are kept as is.
+func FormatMessage[V any](message string, args map[string]V) string {
+	if len(args) == 0 || !strings.Contains(message, "{") {
+		return message
+	}
+
+	var buf strings.Builder
+	buf.Grow(len(message))
+	for {
+		start := strings.IndexByte(message, '{')
+		if start == -1 {
+			break
+		}
+		end := strings.IndexByte(message[start+1:], '}')
+		if end == -1 {
+			break
+		}
+		end += start + 1
+
+		arg, ok := args[message[start+1:end]]
+		if !ok {
+			buf.WriteString(message[:end+1])
+			message = message[end+1:]
+			continue
+		}
+		buf.WriteString(message[:start])
+		buf.WriteString(fmt.Sprint(arg))
+		message = message[end+1:]
+	}
+	buf.WriteString(message)
+	return buf.String()
+}
+
+// GRPCCode converts the error code into the corresponding gRPC status code.
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case OK:
+		return codes.OK
+	case Canceled:
+		return codes.Canceled
+	case UnknownError:
+		return codes.Unknown
+	case NotImplemented:
+		return codes.Unimplemented
+	case ServiceUnavailable:
+		return codes.Unavailable
+	case InternalServerError:
+		return codes.Internal
+	case TooManyRequests:
+		return codes.ResourceExhausted
+	case RequestTimeout:
+		return codes.DeadlineExceeded
+	case BadRequest:
+		return codes.FailedPrecondition
+	case Conflict:
+		return codes.AlreadyExists
+	case InvalidArgument:
+		return codes.InvalidArgument
+	case NotFound:
+		return codes.NotFound
+	case AccessDenied:
+		return codes.PermissionDenied
+	case Unauthorized:
+		return codes.Unauthenticated
+	}
+	if cd, ok := codeMap[c]; ok && cd.GRPCCode != codes.OK {
+		return cd.GRPCCode
+	}
+	return codes.Unknown
+}
+
 // FromGRPCCode converts a gRPC error code into the corresponding ecodes.Code.
 func FromGRPCCode(code codes.Code) Code {
 	switch code {
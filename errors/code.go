@@ -0,0 +1,95 @@
+package errors
+
+import (
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/utils/debug"
+	"google.golang.org/grpc/status"
+)
+
+// CodeInfo business code information bound to an error by WithCode.
+type CodeInfo struct {
+	Code ecodes.Code
+	// Level overrides the default log level of the code when not nil.
+	Level *log.Level
+	// Message overrides the message of the code when not empty.
+	Message string
+}
+
+// CodeOption is a WithCode option.
+type CodeOption func(*CodeInfo)
+
+// WithCodeLevel used to set the log level bound to the error.
+func WithCodeLevel(level log.Level) CodeOption {
+	return func(c *CodeInfo) {
+		c.Level = &level
+	}
+}
+
+// WithCodeMessage used to set the message bound to the error.
+func WithCodeMessage(message string) CodeOption {
+	return func(c *CodeInfo) {
+		c.Message = message
+	}
+}
+
+// WithCode binds a business code to the error, so that domain layers can return plain errors
+// and leave the conversion to the transport layer.
+func WithCode(err error, code ecodes.Code, opts ...CodeOption) error {
+	if err == nil {
+		return nil
+	}
+	info := &CodeInfo{Code: code}
+	for _, o := range opts {
+		o(info)
+	}
+	return &withCaller{
+		err:    err,
+		caller: debug.Caller(2),
+		stack:  originStack(err, 2),
+		code:   info,
+	}
+}
+
+// RecoveredCode returns the code information of a recovered panic value, panics with errors bound with a code
+// or known to the error translators use that code information, others are reported as InternalServerError.
+func RecoveredCode(v any) *CodeInfo {
+	if e, ok := v.(error); ok {
+		if info, ok := CodeOf(e); ok {
+			return info
+		}
+	}
+	return &CodeInfo{Code: ecodes.InternalServerError}
+}
+
+// OuterCodeOf returns the business code bound outside any gRPC status or kratos error of the error tree,
+// i.e. a code that takes precedence over the code of the wrapped status. The translators are not consulted.
+func OuterCodeOf(err error) (*CodeInfo, bool) {
+	var info *CodeInfo
+	walk(err, func(err error) bool {
+		if wc, ok := err.(*withCaller); ok && wc.code != nil {
+			info = wc.code
+			return false
+		}
+		_, isStatus := err.(interface{ GRPCStatus() *status.Status })
+		return !isStatus
+	})
+	return info, info != nil
+}
+
+// CodeOf returns the business code bound to the error tree, the outermost binding wins.
+// Errors without binding are classified by the registered translators.
+func CodeOf(err error) (*CodeInfo, bool) {
+	var info *CodeInfo
+	walk(err, func(err error) bool {
+		if wc, ok := err.(*withCaller); ok && wc.code != nil {
+			info = wc.code
+			return false
+		}
+		return true
+	})
+	if info != nil {
+		return info, true
+	}
+	return Translate(err)
+}
@@ -3,7 +3,8 @@ package errors
 import (
 	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"slices"
 
 	"github.com/yearm/kratos-pkg/utils/debug"
 )
@@ -13,6 +14,9 @@ type withCaller struct {
 	err     error
 	message string
 	caller  string
+	stack   *stack
+	fields  []any
+	code    *CodeInfo
 }
 
 // Error implements error interface, returns formatted message.
@@ -28,6 +32,25 @@ func (w *withCaller) Error() string {
 	return w.message + ": " + errString
 }
 
+// Format implements fmt.Formatter, %+v prints the message followed by the full stack trace if captured.
+func (w *withCaller) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			_, _ = io.WriteString(s, w.Error())
+			if st := findStack(w); st != nil {
+				_, _ = io.WriteString(s, "\n"+st.String())
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, w.Error())
+	case 'q':
+		_, _ = fmt.Fprintf(s, "%q", w.Error())
+	}
+}
+
 // Cause returns the original wrapped error.
 func (w *withCaller) Cause() error {
 	return w.err
@@ -43,14 +66,17 @@ func New(text string) error {
 	return &withCaller{
 		err:    errors.New(text),
 		caller: debug.Caller(2),
+		stack:  originStack(nil, 2),
 	}
 }
 
 // Errorf creates a formatted error with caller location.
 func Errorf(format string, a ...any) error {
+	err := fmt.Errorf(format, a...)
 	return &withCaller{
-		err:    fmt.Errorf(format, a...),
+		err:    err,
 		caller: debug.Caller(2),
+		stack:  originStack(err, 2),
 	}
 }
 
@@ -64,6 +90,7 @@ func Wrap(err error, msg ...string) error {
 		err:     err,
 		message: message,
 		caller:  debug.Caller(2),
+		stack:   originStack(err, 2),
 	}
 }
 
@@ -73,6 +100,7 @@ func Wrapf(err error, format string, args ...any) error {
 		err:     err,
 		message: fmt.Sprintf(format, args...),
 		caller:  debug.Caller(2),
+		stack:   originStack(err, 2),
 	}
 }
 
@@ -81,53 +109,142 @@ func WrapDepth(err error, depth int) error {
 	return &withCaller{
 		err:    err,
 		caller: debug.Caller(depth),
+		stack:  originStack(err, depth),
+	}
+}
+
+// WithFields attaches structured key/value fields such as "orderId", id to the error.
+func WithFields(err error, keyvals ...any) error {
+	if err == nil {
+		return nil
 	}
+	return &withCaller{
+		err:    err,
+		caller: debug.Caller(2),
+		stack:  originStack(err, 2),
+		fields: keyvals,
+	}
+}
+
+// Fields collects the key/value fields attached across the error tree,
+// fields attached by outer wrappers take precedence over the inner ones.
+func Fields(err error) map[string]any {
+	fields := make(map[string]any)
+	walk(err, func(err error) bool {
+		if wc, ok := err.(*withCaller); ok {
+			for i := 0; i+1 < len(wc.fields); i += 2 {
+				key := fmt.Sprint(wc.fields[i])
+				if _, ok := fields[key]; !ok {
+					fields[key] = wc.fields[i+1]
+				}
+			}
+		}
+		return true
+	})
+	return fields
 }
 
-// Cause retrieves the root cause error from the chain.
+// Cause retrieves the root cause error from the chain, it follows the first error of multi-unwrap errors.
+// Use Causes to retrieve all root causes of an error tree.
 func Cause(err error) error {
 	type causer interface {
 		Cause() error
 	}
 
 	for err != nil {
-		c, ok := err.(causer)
-		if !ok {
-			break
+		switch x := err.(type) {
+		case causer:
+			err = x.Cause()
+		case interface{ Unwrap() []error }:
+			errs := x.Unwrap()
+			if len(errs) == 0 {
+				return err
+			}
+			err = errs[0]
+		default:
+			return err
 		}
-		err = c.Cause()
 	}
 	return err
 }
 
-// Callers extracts call location chain from error.
-func Callers(err error) string {
-	type unwraper interface {
-		Unwrap() error
+// Causes retrieves all root cause errors from the error tree, e.g. every leaf of errors joined by Join.
+func Causes(err error) []error {
+	var causes []error
+	for err != nil {
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				causes = append(causes, Causes(e)...)
+			}
+			return causes
+		case interface{ Unwrap() error }:
+			if next := x.Unwrap(); next != nil {
+				err = next
+				continue
+			}
+		}
+		return append(causes, err)
 	}
+	return causes
+}
+
+// Callers extracts the call location branches from the error tree, from the outermost to the innermost.
+// A plain error chain produces a single branch, errors joined by Join produce one branch per joined error.
+func Callers(err error) [][]string {
+	branches := callerBranches(err, nil)
+	if branches == nil {
+		return [][]string{}
+	}
+	return branches
+}
 
-	var (
-		buf  strings.Builder
-		flag bool
-	)
-	buf.Grow(256)
-	buf.WriteString("[")
+// callerBranches walks the error tree and appends the call locations to prefix.
+func callerBranches(err error, prefix []string) [][]string {
 	for err != nil {
-		if wc := new(withCaller); errors.As(err, &wc) {
-			if flag {
-				buf.WriteString(", ")
+		if wc, ok := err.(*withCaller); ok && wc.caller != "" {
+			prefix = append(prefix, wc.caller)
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			var branches [][]string
+			for _, e := range x.Unwrap() {
+				branches = append(branches, callerBranches(e, slices.Clip(prefix))...)
 			}
-			buf.WriteString(fmt.Sprintf(`"%v"`, wc.caller))
-			flag = true
+			return branches
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		default:
+			err = nil
+		}
+	}
+	if len(prefix) == 0 {
+		return nil
+	}
+	return [][]string{prefix}
+}
+
+// walk visits the errors of the error tree in depth-first order until visit returns false.
+func walk(err error, visit func(error) bool) bool {
+	for err != nil {
+		if !visit(err) {
+			return false
 		}
-		u, ok := err.(unwraper)
-		if !ok {
-			break
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				if !walk(e, visit) {
+					return false
+				}
+			}
+			return true
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		default:
+			return true
 		}
-		err = u.Unwrap()
 	}
-	buf.WriteString("]")
-	return buf.String()
+	return true
 }
 
 // Standard library compatibility functions:
@@ -0,0 +1,100 @@
+package errors
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/yearm/kratos-pkg/utils/debug"
+)
+
+// maxStackDepth maximum number of frames captured for a stack trace.
+const maxStackDepth = 64
+
+// stackEnabled controls whether errors capture the full stack trace at their origin.
+var stackEnabled atomic.Bool
+
+// EnableStack switches the full stack trace capture mode globally, it is disabled by default.
+// When enabled, New, Errorf and the first Wrap of an error chain capture the program counters once,
+// the symbolization is deferred until the trace is printed.
+func EnableStack(enable bool) {
+	stackEnabled.Store(enable)
+}
+
+// stack holds the program counters captured at the error origin.
+type stack struct {
+	pcs   []uintptr
+	once  sync.Once
+	trace string
+}
+
+// newStack captures the program counters of the current goroutine, depth: call stack depth.
+func newStack(depth int) *stack {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(depth+1, pcs[:])
+	return &stack{pcs: append([]uintptr(nil), pcs[:n]...)}
+}
+
+// originStack captures a stack when the capture mode is enabled and the error chain does not have one yet.
+func originStack(err error, depth int) *stack {
+	if !stackEnabled.Load() || findStack(err) != nil {
+		return nil
+	}
+	return newStack(depth + 1)
+}
+
+// String symbolizes the program counters lazily, one "function\n\tfile:line" entry per frame.
+func (s *stack) String() string {
+	s.once.Do(func() {
+		var buf strings.Builder
+		frames := runtime.CallersFrames(s.pcs)
+		for {
+			frame, more := frames.Next()
+			if frame.Function != "" {
+				buf.WriteString(fmt.Sprintf("%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line))
+			}
+			if !more {
+				break
+			}
+		}
+		s.trace = strings.TrimSuffix(buf.String(), "\n")
+	})
+	return s.trace
+}
+
+// WithStack wraps the error with the full stack trace regardless of the capture mode,
+// e.g. for the panics recovered in background goroutines.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &withCaller{
+		err:    err,
+		caller: debug.Caller(2),
+		stack:  newStack(2),
+	}
+}
+
+// findStack returns the first stack captured in the error tree, nil if there is none.
+func findStack(err error) *stack {
+	var s *stack
+	walk(err, func(err error) bool {
+		if wc, ok := err.(*withCaller); ok && wc.stack != nil {
+			s = wc.stack
+			return false
+		}
+		return true
+	})
+	return s
+}
+
+// StackTrace returns the full stack trace captured at the origin of the error chain,
+// empty if the error was created while the capture mode was disabled.
+func StackTrace(err error) string {
+	if s := findStack(err); s != nil {
+		return s.String()
+	}
+	return ""
+}
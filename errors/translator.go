@@ -0,0 +1,83 @@
+package errors
+
+import (
+	"context"
+	"sync"
+
+	"github.com/yearm/kratos-pkg/ecodes"
+)
+
+// Translator translates an unclassified error into business code information, ok reports whether it matches.
+type Translator func(err error) (info *CodeInfo, ok bool)
+
+var (
+	// translators global translator registry, consulted in registration order.
+	translators  []Translator
+	translatorMu sync.RWMutex
+)
+
+func init() {
+	RegisterTranslators(
+		TranslateIs(context.DeadlineExceeded, ecodes.RequestTimeout),
+		TranslateIs(context.Canceled, ecodes.Canceled),
+	)
+}
+
+// RegisterTranslators registers translators for third-party errors, e.g.
+//
+//	errors.RegisterTranslators(
+//		errors.TranslateIs(gorm.ErrRecordNotFound, ecodes.NotFound),
+//		errors.TranslateFunc(func(err error) bool {
+//			var e *mysql.MySQLError
+//			return errors.As(err, &e) && e.Number == 1062
+//		}, ecodes.Conflict),
+//	)
+func RegisterTranslators(ts ...Translator) {
+	translatorMu.Lock()
+	defer translatorMu.Unlock()
+	translators = append(translators, ts...)
+}
+
+// Translate consults the registered translators, the first matching translator wins.
+func Translate(err error) (*CodeInfo, bool) {
+	if err == nil {
+		return nil, false
+	}
+	translatorMu.RLock()
+	defer translatorMu.RUnlock()
+	for _, t := range translators {
+		if info, ok := t(err); ok {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+// TranslateIs returns a translator matching the errors that Is the target sentinel error.
+func TranslateIs(target error, code ecodes.Code, opts ...CodeOption) Translator {
+	return TranslateFunc(func(err error) bool {
+		return Is(err, target)
+	}, code, opts...)
+}
+
+// TranslateAs returns a translator matching the errors that can be converted to the error type T.
+func TranslateAs[T error](code ecodes.Code, opts ...CodeOption) Translator {
+	return TranslateFunc(func(err error) bool {
+		var target T
+		return As(err, &target)
+	}, code, opts...)
+}
+
+// TranslateFunc returns a translator matching the errors that the predicate reports true.
+func TranslateFunc(match func(err error) bool, code ecodes.Code, opts ...CodeOption) Translator {
+	info := &CodeInfo{Code: code}
+	for _, o := range opts {
+		o(info)
+	}
+	return func(err error) (*CodeInfo, bool) {
+		if !match(err) {
+			return nil, false
+		}
+		return info, true
+	}
+}
@@ -161,3 +161,12 @@ func NewAliyunLogger(localType ...Type) (log.Logger, func(), error) {
 	ac := aliyun.NewConfig(c.AccessKey, c.SecretKey, c.Endpoint, c.Project, c.Logstore, c.Level)
 	return aliyun.NewLogger(ac)
 }
+
+// FieldKeyvals converts the fields into the key/value pair of FieldsKey, e.g. for log.Logger.Log, so that the
+// fields cannot overwrite the reserved keys like msg or request. It is empty if there are no fields.
+func FieldKeyvals(fields map[string]any) []any {
+	if len(fields) == 0 {
+		return nil
+	}
+	return []any{FieldsKey, fields}
+}
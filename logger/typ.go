@@ -1,8 +1,12 @@
 package logger
 
+import "github.com/yearm/kratos-pkg/ecodes"
+
 const (
 	RequestKey  = "request"
 	ResponseKey = "response"
+	StreamKey   = "stream"
+	FieldsKey   = "fields"
 )
 
 // RequestLog contains request-specific information
@@ -13,6 +17,7 @@ type RequestLog struct {
 	Header   string `json:"header"`
 	Req      string `json:"req"`
 	ClientIP string `json:"clientIP"`
+	Peer     string `json:"peer,omitempty"`
 	Extra    string `json:"extra"`
 }
 
@@ -23,12 +28,33 @@ type ResponseLog struct {
 	ErrorDetail *ErrorDetailLog `json:"errorDetail,omitempty"`
 	Reply       string          `json:"reply"`
 	Latency     int64           `json:"latency"`
+	Stack       string          `json:"stack,omitempty"`
 }
 
 // ErrorDetailLog contains error detail information
 type ErrorDetailLog struct {
-	Code    uint32 `json:"code"`
-	Message string `json:"message"`
-	Level   string `json:"level"`
-	Callers string `json:"callers"`
+	Code     uint32            `json:"code"`
+	Message  string            `json:"message"`
+	Level    string            `json:"level"`
+	Severity string            `json:"severity,omitempty"`
+	Callers  [][]string        `json:"callers"`
+	Args     map[string]string `json:"args,omitempty"`
+	Origin   string            `json:"origin,omitempty"`
+	Hops     int               `json:"hops,omitempty"`
+}
+
+// StreamLog contains streaming-specific information
+type StreamLog struct {
+	RecvMsgs  int64 `json:"recvMsgs"`
+	SentMsgs  int64 `json:"sentMsgs"`
+	RecvBytes int64 `json:"recvBytes"`
+	SentBytes int64 `json:"sentBytes"`
+}
+
+// SeverityValue returns the logged value of the severity, it is empty for SeverityNone so that it is omitted.
+func SeverityValue(s ecodes.Severity) string {
+	if s == ecodes.SeverityNone {
+		return ""
+	}
+	return s.String()
 }
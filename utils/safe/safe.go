@@ -0,0 +1,130 @@
+// Package safe provides goroutine helpers that recover panics, so that a panic in a background
+// goroutine is logged with its trace context instead of crashing the whole process.
+package safe
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/utils/gjson"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	kindGo    = "go"
+	kindGroup = "group"
+)
+
+// panicCounter counts the panics recovered by the helpers.
+var panicCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "safe_goroutine_panics_total",
+	Help: "The total number of panics recovered in goroutines.",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(panicCounter)
+}
+
+// Go runs fn in a new goroutine, the panic is recovered and logged with the trace context of ctx.
+func Go(ctx context.Context, fn func(ctx context.Context)) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				_ = panicError(ctx, kindGo, r)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// GoWithTimeout runs fn in a new goroutine with a context detached from the cancellation of ctx,
+// the context keeps the values of ctx such as the trace context and is canceled after timeout.
+func GoWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	Go(ctx, func(ctx context.Context) {
+		defer cancel()
+		fn(ctx)
+	})
+}
+
+// Group is an errgroup.Group that recovers the panics of its goroutines into errors.
+// A zero Group is valid like a zero errgroup.Group, it logs the panics without trace context.
+type Group struct {
+	ctx  context.Context
+	eg   *errgroup.Group
+	once sync.Once
+}
+
+// WithContext returns a new Group and an associated Context derived from ctx, see errgroup.WithContext.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	eg, ctx := errgroup.WithContext(ctx)
+	return &Group{ctx: ctx, eg: eg}, ctx
+}
+
+// Go calls the given function in a new goroutine, a panic is returned as the error of the function.
+func (g *Group) Go(fn func() error) {
+	g.group().Go(g.wrap(fn))
+}
+
+// TryGo calls the given function in a new goroutine only if the number of active goroutines is below the limit.
+func (g *Group) TryGo(fn func() error) bool {
+	return g.group().TryGo(g.wrap(fn))
+}
+
+// SetLimit limits the number of active goroutines in this group to at most n.
+func (g *Group) SetLimit(n int) {
+	g.group().SetLimit(n)
+}
+
+// Wait blocks until all function calls have returned, then returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	return g.group().Wait()
+}
+
+// group returns the errgroup.Group, it is created on first use for a zero Group.
+func (g *Group) group() *errgroup.Group {
+	g.once.Do(func() {
+		if g.eg == nil {
+			g.eg = &errgroup.Group{}
+		}
+		if g.ctx == nil {
+			g.ctx = context.Background()
+		}
+	})
+	return g.eg
+}
+
+// wrap recovers the panic of fn into its error.
+func (g *Group) wrap(fn func() error) func() error {
+	return func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = panicError(g.ctx, kindGroup, r)
+			}
+		}()
+		return fn()
+	}
+}
+
+// panicError converts the recovered value into an error with stack trace, then logs and counts it.
+func panicError(ctx context.Context, kind string, r any) error {
+	var err error
+	if e, ok := r.(error); ok {
+		err = fmt.Errorf("panic: %w", e)
+	} else {
+		err = fmt.Errorf("panic: %v", r)
+	}
+	err = errors.WithStack(err)
+
+	log.Context(ctx).Error(gjson.MustMarshalToString(map[string]any{
+		"error": err.Error(),
+		"stack": errors.StackTrace(err),
+	}))
+	panicCounter.WithLabelValues(kind).Inc()
+	return err
+}
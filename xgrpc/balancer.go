@@ -0,0 +1,214 @@
+package xgrpc
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/registry"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/selector/filter"
+	"github.com/go-kratos/kratos/v2/selector/p2c"
+	"github.com/go-kratos/kratos/v2/selector/random"
+	"github.com/go-kratos/kratos/v2/selector/wrr"
+	"github.com/go-kratos/kratos/v2/transport"
+	kgrpc "github.com/go-kratos/kratos/v2/transport/grpc"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+const (
+	// BalancerP2C power of two choices balancer.
+	BalancerP2C = "p2c"
+	// BalancerWRR weighted round-robin balancer.
+	BalancerWRR = "wrr"
+	// BalancerRandom random balancer.
+	BalancerRandom = "random"
+)
+
+// balancerGlobal name of the kratos balancer backed by the global kratos selector, which every kratos client
+// uses. This package registers it again, so that the calls also apply the node selection of their client config,
+// see selectionInterceptor, and the hedged attempts exclude the nodes already tried. The other calls are picked
+// like the kratos balancer does.
+const balancerGlobal = "selector"
+
+// balancerBuilders selector builders of the balancers that can be chosen per client.
+var balancerBuilders = map[string]selector.Builder{
+	BalancerP2C:    p2c.NewBuilder(),
+	BalancerWRR:    wrr.NewBuilder(),
+	BalancerRandom: random.NewBuilder(),
+}
+
+func init() {
+	// the kratos client package is initialized first, so this registration replaces its balancer.
+	balancer.Register(base.NewBalancerBuilder(balancerGlobal, &balancerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// checkBalancer returns an error if the balancer is unknown, empty means the global kratos selector.
+func checkBalancer(name string) error {
+	if _, ok := balancerBuilders[name]; name != "" && !ok {
+		return fmt.Errorf("unknown balancer: %s", name)
+	}
+	return nil
+}
+
+// nodeSelection selection of the nodes configured by the client config.
+type nodeSelection struct {
+	// balancer name of the balancer, empty means the global kratos selector.
+	balancer string
+	// filters node filters applied after the ones of the kratos client.
+	filters []selector.NodeFilter
+}
+
+type nodeSelectionKey struct{}
+
+// selectionInterceptor is a unary client interceptor that passes the node selection to the balancer. It comes last,
+// so that only the calls sent by the client carry it, not the ones the other interceptors and fallbacks make.
+func selectionInterceptor(s *nodeSelection) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(context.WithValue(ctx, nodeSelectionKey{}, s), method, req, reply, cc, opts...)
+	}
+}
+
+// streamSelectionInterceptor is a stream client interceptor that passes the node selection to the balancer.
+func streamSelectionInterceptor(s *nodeSelection) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(context.WithValue(ctx, nodeSelectionKey{}, s), desc, cc, method, opts...)
+	}
+}
+
+// balancerBuilder builds the gRPC pickers backed by the kratos selectors.
+type balancerBuilder struct{}
+
+// Build creates a grpc Picker.
+func (b *balancerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	nodes := make([]selector.Node, 0, len(info.ReadySCs))
+	for conn, info := range info.ReadySCs {
+		ins, _ := info.Address.Attributes.Value("rawServiceInstance").(*registry.ServiceInstance)
+		nodes = append(nodes, &grpcNode{
+			Node:    selector.NewNode("grpc", info.Address.Addr, ins),
+			subConn: conn,
+		})
+	}
+	return &balancerPicker{nodes: nodes, selectors: make(map[string]selector.Selector)}
+}
+
+// balancerPicker picks the sub connections through the kratos selector of the balancer of the call, applying
+// the node filters of the call. The hedged attempts of a call are sent to the nodes not tried yet, see hedgeInterceptor.
+type balancerPicker struct {
+	nodes     []selector.Node
+	mu        sync.Mutex
+	selectors map[string]selector.Selector
+}
+
+// selector returns the selector of the balancer, it is built on first use.
+func (p *balancerPicker) selector(name string) selector.Selector {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.selectors[name]; ok {
+		return s
+	}
+	builder, ok := balancerBuilders[name]
+	if !ok {
+		// the global selector is looked up on every build, as it may be replaced after init.
+		builder = selector.GlobalSelector()
+	}
+	s := builder.Build()
+	s.Apply(p.nodes)
+	p.selectors[name] = s
+	return s
+}
+
+// Pick pick instances.
+func (p *balancerPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var filters []selector.NodeFilter
+	if tr, ok := transport.FromClientContext(info.Ctx); ok {
+		if gtr, ok := tr.(*kgrpc.Transport); ok {
+			filters = gtr.NodeFilters()
+		}
+	}
+
+	// the node filters of the transport are shared by the calls, so the slice is clipped before appending.
+	filters = slices.Clip(filters)
+	var name string
+	if s, ok := info.Ctx.Value(nodeSelectionKey{}).(*nodeSelection); ok {
+		name = s.balancer
+		filters = append(filters, s.filters...)
+	}
+	if _, ok := info.Ctx.Value(nodeBreakersKey{}).(*nodeBreakers); ok {
+		filters = append(filters, breakerNodeFilter)
+	}
+	tried, hedged := info.Ctx.Value(triedNodesKey{}).(*triedNodes)
+	if hedged {
+		filters = append(filters, tried.filter)
+	}
+
+	n, done, err := p.selector(name).Select(info.Ctx, selector.WithNodeFilter(filters...))
+	if err != nil {
+		return balancer.PickResult{}, err
+	}
+	if hedged {
+		tried.add(n.Address())
+	}
+	return balancer.PickResult{
+		SubConn: n.(*grpcNode).subConn,
+		Done: func(di balancer.DoneInfo) {
+			done(info.Ctx, selector.DoneInfo{
+				Err:           di.Err,
+				BytesSent:     di.BytesSent,
+				BytesReceived: di.BytesReceived,
+				ReplyMD:       kgrpc.Trailer(di.Trailer),
+			})
+		},
+	}, nil
+}
+
+// grpcNode is a selector node bound to a gRPC sub connection.
+type grpcNode struct {
+	selector.Node
+	subConn balancer.SubConn
+}
+
+// nodeFilters converts the node filter config into the kratos node filters.
+func nodeFilters(c *gconfig.NodeFilterConfig) []selector.NodeFilter {
+	if c == nil {
+		return nil
+	}
+	var filters []selector.NodeFilter
+	if c.Version != "" {
+		filters = append(filters, filter.Version(c.Version))
+	}
+	if len(c.Metadata) > 0 {
+		filters = append(filters, metadataFilter(c.Metadata))
+	}
+	return filters
+}
+
+// metadataFilter is a node filter that keeps the nodes whose metadata contain all the pairs of md.
+func metadataFilter(md map[string]string) selector.NodeFilter {
+	return func(_ context.Context, nodes []selector.Node) []selector.Node {
+		newNodes := make([]selector.Node, 0, len(nodes))
+		for _, n := range nodes {
+			if matchMetadata(n.Metadata(), md) {
+				newNodes = append(newNodes, n)
+			}
+		}
+		return newNodes
+	}
+}
+
+// matchMetadata reports whether metadata contains all the pairs of md.
+func matchMetadata(metadata, md map[string]string) bool {
+	for k, v := range md {
+		if metadata[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,338 @@
+package xgrpc
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kratos/aegis/circuitbreaker"
+	"github.com/go-kratos/aegis/circuitbreaker/sre"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/utils/group"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	// breakerOpenGauge whether the breakers are rejecting requests.
+	breakerOpenGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_client_breaker_open",
+		Help: "Whether the gRPC client circuit breaker is open (1) or closed (0) by target, operation and node if enabled.",
+	}, []string{"target", "operation", "node"})
+
+	// breakerRejectionCounter number of the requests rejected by the breakers.
+	breakerRejectionCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_breaker_rejections_total",
+		Help: "The total number of gRPC client requests rejected by the circuit breaker by target, operation and node if enabled.",
+	}, []string{"target", "operation", "node"})
+)
+
+func init() {
+	prometheus.MustRegister(breakerOpenGauge, breakerRejectionCounter)
+}
+
+// BreakerFallback handles the requests rejected by the circuit breaker, err is the ServiceUnavailable error of the rejection.
+// The reply must be of the reply type of the operation, it takes effect on the connections created by this package.
+type BreakerFallback func(ctx context.Context, req any, err error) (any, error)
+
+// BreakerOption circuit breaker option.
+type BreakerOption func(*breakerOptions)
+
+// breakerOptions circuit breaker options.
+type breakerOptions struct {
+	sreOptions  []sre.Option
+	fallbacks   map[string]BreakerFallback
+	perEndpoint bool
+	nodeMetrics bool
+}
+
+// WithBreakerConfig used to set the thresholds of the breakers from the config, e.g. client.grpc.<name>.breaker.
+func WithBreakerConfig(c *gconfig.BreakerConfig) BreakerOption {
+	return func(options *breakerOptions) {
+		if c == nil {
+			return
+		}
+		if c.Success > 0 {
+			options.sreOptions = append(options.sreOptions, sre.WithSuccess(c.Success))
+		}
+		if c.Request > 0 {
+			options.sreOptions = append(options.sreOptions, sre.WithRequest(c.Request))
+		}
+		if c.Window > 0 {
+			options.sreOptions = append(options.sreOptions, sre.WithWindow(c.Window.Duration()))
+		}
+		if c.Bucket > 0 {
+			options.sreOptions = append(options.sreOptions, sre.WithBucket(c.Bucket))
+		}
+		options.perEndpoint = options.perEndpoint || c.PerEndpoint
+		options.nodeMetrics = options.nodeMetrics || c.NodeMetrics
+	}
+}
+
+// WithBreakerFallback used to set the fallback of the requests of the operation rejected by the breaker,
+// it takes precedence over the one set by SetBreakerFallback.
+func WithBreakerFallback(operation string, fallback BreakerFallback) BreakerOption {
+	return func(options *breakerOptions) {
+		options.fallbacks[operation] = fallback
+	}
+}
+
+// WithBreakerPerEndpoint used to key the breakers by the endpoint as well as the operation, so that an unhealthy
+// instance is excluded from the selection instead of tripping the whole operation.
+func WithBreakerPerEndpoint() BreakerOption {
+	return func(options *breakerOptions) {
+		options.perEndpoint = true
+	}
+}
+
+// WithBreakerNodeMetrics used to label the metrics of the breakers keyed by endpoint with the instance address,
+// the label is empty by default as the number of the instances is unbounded.
+func WithBreakerNodeMetrics() BreakerOption {
+	return func(options *breakerOptions) {
+		options.nodeMetrics = true
+	}
+}
+
+// breakerFallbacks fallbacks of the operations keyed by the operation, see SetBreakerFallback.
+var breakerFallbacks sync.Map
+
+// SetBreakerFallback sets the fallback of the requests of the operation rejected by the breakers,
+// including the ones installed by the connections created by this package, see connBreaker.
+func SetBreakerFallback(operation string, fallback BreakerFallback) {
+	breakerFallbacks.Store(operation, fallback)
+}
+
+// ClientBreaker circuit breaker middleware will return ServiceUnavailable when the circuit
+// breaker is triggered and the request is rejected directly, or the result of the fallback of the operation.
+// The breakers keyed by endpoint reject a request only when the breakers of all the instances are open.
+// The connections created by this package install their own, see connBreaker.
+func ClientBreaker(opts ...BreakerOption) middleware.Middleware {
+	o := breakerOptions{fallbacks: make(map[string]BreakerFallback)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	gp := group.NewGroup(func() circuitbreaker.CircuitBreaker {
+		return sre.NewBreaker(o.sreOptions...)
+	})
+	return func(next middleware.Handler) middleware.Handler {
+		// the calls let through are marked for connBreaker, not the ones the fallbacks make.
+		handler := func(ctx context.Context, req any) (any, error) {
+			return next(context.WithValue(ctx, breakerAppliedKey{}, struct{}{}), req)
+		}
+		return func(ctx context.Context, req any) (any, error) {
+			info, _ := transport.FromClientContext(ctx)
+			target, operation := info.Endpoint(), info.Operation()
+			fallback := o.fallback(operation)
+			if o.perEndpoint {
+				nb := &nodeBreakers{group: gp, target: target, operation: operation, nodeMetrics: o.nodeMetrics}
+				return breakByEndpoint(ctx, req, handler, nb, fallback)
+			}
+
+			breaker := gp.Get(operation)
+			if err := breaker.Allow(); err != nil {
+				breaker.MarkFailed()
+				breakerOpenGauge.WithLabelValues(target, operation, "").Set(1)
+				breakerRejectionCounter.WithLabelValues(target, operation, "").Inc()
+				return reject(ctx, req, handler, fallback, err)
+			}
+			reply, err := handler(ctx, req)
+			markBreaker(breaker, err, target, operation, "")
+			return reply, err
+		}
+	}
+}
+
+// fallback returns the fallback of the operation, see WithBreakerFallback and SetBreakerFallback.
+func (o *breakerOptions) fallback(operation string) BreakerFallback {
+	if fallback, ok := o.fallbacks[operation]; ok {
+		return fallback
+	}
+	fallback, _ := breakerFallbacks.Load(operation)
+	f, _ := fallback.(BreakerFallback)
+	return f
+}
+
+// breakerAppliedKey context key marking the calls let through by a ClientBreaker.
+type breakerAppliedKey struct{}
+
+// connBreaker returns the ClientBreaker installed by the connections created by this package, configured by the
+// client config. It steps aside for the calls that a ClientBreaker among the middlewares of the client has
+// already let through, so that the calls do not pass two breakers.
+func connBreaker(c *gconfig.ClientGRPCConfig) middleware.Middleware {
+	breaker := ClientBreaker(WithBreakerConfig(c.Breaker))
+	return func(handler middleware.Handler) middleware.Handler {
+		next := breaker(handler)
+		return func(ctx context.Context, req any) (any, error) {
+			if ctx.Value(breakerAppliedKey{}) != nil {
+				return handler(ctx, req)
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// breakByEndpoint invokes the handler with the instances whose breakers are open excluded, see breakerNodeFilter,
+// and marks the breaker of the selected instance unless the hedged attempts have marked theirs, see hedgePolicy.
+func breakByEndpoint(ctx context.Context, req any, handler middleware.Handler, nb *nodeBreakers, fallback BreakerFallback) (any, error) {
+	reply, err := handler(context.WithValue(ctx, nodeBreakersKey{}, nb), req)
+	if err != nil && nb.allRejected() {
+		return reject(ctx, req, handler, fallback, circuitbreaker.ErrNotAllowed)
+	}
+	if p, ok := selector.FromPeerContext(ctx); ok && p.Node != nil && !nb.hedged() {
+		nb.mark(p.Node.Address(), err)
+	}
+	return reply, err
+}
+
+// reject returns the ServiceUnavailable error of the rejected request, or the result of the fallback.
+// The replies returned by the client middlewares are discarded by the kratos client, so the reply of the fallback
+// is passed through the handler instead of sending the request, see replyFallback.
+func reject(ctx context.Context, req any, handler middleware.Handler, fallback BreakerFallback, err error) (any, error) {
+	err = status.Error(ctx, ecodes.ServiceUnavailable, err)
+	if fallback == nil {
+		return nil, err
+	}
+	reply, err := fallback(ctx, req, err)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, fallbackReplyKey{}, reply), req)
+}
+
+// fallbackReplyKey context key of the reply of the breaker fallback.
+type fallbackReplyKey struct{}
+
+// fallbackInterceptor is a unary client interceptor that replies with the reply of the breaker fallback
+// instead of sending the request, for the breakers among the middlewares of the kratos client.
+func fallbackInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if ok, err := replyFallback(ctx, reply); ok {
+		return err
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// replyFallback merges the reply of the breaker fallback into reply, it reports false if the call has none.
+func replyFallback(ctx context.Context, reply any) (bool, error) {
+	fr, ok := ctx.Value(fallbackReplyKey{}).(proto.Message)
+	if !ok {
+		return false, nil
+	}
+	r, ok := reply.(proto.Message)
+	if !ok || r.ProtoReflect().Descriptor() != fr.ProtoReflect().Descriptor() {
+		return true, status.Error(ctx, ecodes.InternalServerError, errors.Errorf("fallback reply %T mismatches %T", fr, reply))
+	}
+	proto.Merge(r, fr)
+	return true, nil
+}
+
+// markBreaker marks the result of the request, the breaker is reported closed once a request succeeds.
+func markBreaker(breaker circuitbreaker.CircuitBreaker, err error, target, operation, node string) {
+	if isBreakerFailure(err) {
+		breaker.MarkFailed()
+		return
+	}
+	breaker.MarkSuccess()
+	breakerOpenGauge.WithLabelValues(target, operation, node).Set(0)
+}
+
+// breakerKey returns the key of the breaker of the operation and the instance.
+func breakerKey(operation, addr string) string {
+	return operation + "@" + addr
+}
+
+// nodeBreakersKey context key of the breakers keyed by endpoint of a call.
+type nodeBreakersKey struct{}
+
+// nodeBreakers breakers keyed by endpoint of a call.
+type nodeBreakers struct {
+	group       *group.Group[circuitbreaker.CircuitBreaker]
+	target      string
+	operation   string
+	nodeMetrics bool
+
+	mu       sync.Mutex
+	rejected bool
+	marked   bool
+}
+
+// allRejected reports whether the last selection of the call rejected all the instances.
+func (b *nodeBreakers) allRejected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rejected
+}
+
+// hedged reports whether the breakers have been marked by the hedged attempts.
+func (b *nodeBreakers) hedged() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.marked
+}
+
+// markAttempt marks the breaker of the instance with the result of a hedged attempt.
+func (b *nodeBreakers) markAttempt(addr string, err error) {
+	b.mu.Lock()
+	b.marked = true
+	b.mu.Unlock()
+	b.mark(addr, err)
+}
+
+// mark marks the breaker of the instance with the result of the request.
+func (b *nodeBreakers) mark(addr string, err error) {
+	markBreaker(b.group.Get(breakerKey(b.operation, addr)), err, b.target, b.operation, b.nodeLabel(addr))
+}
+
+// nodeLabel returns the node label of the metrics, see WithBreakerNodeMetrics.
+func (b *nodeBreakers) nodeLabel(addr string) string {
+	if b.nodeMetrics {
+		return addr
+	}
+	return ""
+}
+
+// breakerNodeFilter is a node filter that excludes the instances whose breakers are open when the breakers
+// are keyed by endpoint, see WithBreakerPerEndpoint. Every excluded instance counts as a rejection and is marked failed
+// like the rejected requests of the breakers keyed by operation.
+func breakerNodeFilter(ctx context.Context, nodes []selector.Node) []selector.Node {
+	b, ok := ctx.Value(nodeBreakersKey{}).(*nodeBreakers)
+	if !ok {
+		return nodes
+	}
+	newNodes := make([]selector.Node, 0, len(nodes))
+	for _, n := range nodes {
+		if breaker := b.group.Get(breakerKey(b.operation, n.Address())); breaker.Allow() != nil {
+			breaker.MarkFailed()
+			breakerOpenGauge.WithLabelValues(b.target, b.operation, b.nodeLabel(n.Address())).Set(1)
+			breakerRejectionCounter.WithLabelValues(b.target, b.operation, b.nodeLabel(n.Address())).Inc()
+			continue
+		}
+		newNodes = append(newNodes, n)
+	}
+	b.mu.Lock()
+	b.rejected = len(nodes) > 0 && len(newNodes) == 0
+	b.mu.Unlock()
+	return newNodes
+}
+
+// isBreakerFailure reports whether err indicates that the downstream is unhealthy. Errors carrying an ErrorDetail,
+// including plain kratos errors, are classified by the business code, others by the HTTP code of the kratos error.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, detail, ok := status.ParseError(err); ok && detail != nil {
+		switch detail.Code {
+		case ecodes.UnknownError, ecodes.InternalServerError, ecodes.ServiceUnavailable, ecodes.RequestTimeout:
+			return true
+		}
+		return false
+	}
+	return kerrors.IsInternalServer(err) || kerrors.IsServiceUnavailable(err) || kerrors.IsGatewayTimeout(err)
+}
@@ -2,79 +2,289 @@ package xgrpc
 
 import (
 	"context"
-	ctls "crypto/tls"
-	"log"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/go-kratos/kratos/v2/middleware"
+	kregistry "github.com/go-kratos/kratos/v2/registry"
 	kgrpc "github.com/go-kratos/kratos/v2/transport/grpc"
 	"github.com/yearm/kratos-pkg/config/gconfig"
 	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/registry"
 	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 )
 
 var (
-	// connMap thread-safe cache for storing gRPC connections keyed by endpoint.
+	// connMap thread-safe cache for storing the gRPC connections keyed by connKey.
 	connMap sync.Map
+	// optionsConnMu serializes the creation of the connections with client options.
+	optionsConnMu sync.Mutex
 
 	// sg deduplicates concurrent connection requests.
 	sg singleflight.Group
+
+	// discovery resolves the discovery endpoints, see SetDiscovery.
+	discovery     kregistry.Discovery
+	discoveryUsed bool
+	discoveryMu   sync.Mutex
 )
 
+// discoveryScheme scheme of the endpoints resolved through the service discovery.
+const discoveryScheme = "discovery"
+
 // GetGRPCClientConnByConfigKey creates a grpc client conn by config key.
 func GetGRPCClientConnByConfigKey(key string, opts ...kgrpc.ClientOption) (*grpc.ClientConn, error) {
 	c, err := gconfig.GetClientGRPCConfig(key)
 	if err != nil {
 		return nil, errors.Wrap(err, "gconfig.GetClientGRPCConfig failed")
 	}
-	return GetGRPCClientConn(c.Endpoint, c.Timeout, c.TLS, opts...)
+	return GetGRPCClientConnByConfig(c, opts...)
 }
 
-// GetGRPCClientConn creates a grpc client conn.
+// GetGRPCClientConn creates a grpc client conn, cached like GetGRPCClientConnByConfig. "discovery:///<service>"
+// endpoints are resolved through the service discovery, see SetDiscovery.
 func GetGRPCClientConn(endpoint string, timeout int, tls bool, opts ...kgrpc.ClientOption) (*grpc.ClientConn, error) {
-	if endpoint == "" {
+	c := &gconfig.ClientGRPCConfig{
+		Endpoint: endpoint,
+		Timeout:  timeout,
+	}
+	if tls {
+		c.TLS = &gconfig.TLSConfig{Enable: true}
+	}
+	return GetGRPCClientConnByConfig(c, opts...)
+}
+
+// GetGRPCClientConnByConfig creates a grpc client conn by config, cached by the name and the content of the config.
+// The balancer and node filters apply to the discovery endpoints, and the middlewares driven by the config
+// (see configMiddlewares) and the hedging are installed as unary interceptors, see dial.
+// The client options apply when the connection is created and cannot be compared, so the connections created
+// with options are not shared with the calls without them, and a call with options fails once a connection
+// of the same config has been created with options.
+// The connections are warmed up before they are returned if the config enables it, they stay open until CloseAll.
+func GetGRPCClientConnByConfig(c *gconfig.ClientGRPCConfig, opts ...kgrpc.ClientOption) (*grpc.ClientConn, error) {
+	if c.Endpoint == "" {
 		return nil, errors.New("endpoint is required")
 	}
 
-	c, err, _ := sg.Do(endpoint, func() (interface{}, error) {
-		if c, ok := connMap.Load(endpoint); ok {
-			return c, nil
+	key := connKey(c, len(opts) > 0)
+	if len(opts) > 0 {
+		// the calls with options do not share the dialing either, the second one must fail.
+		optionsConnMu.Lock()
+		defer optionsConnMu.Unlock()
+		if _, ok := connMap.Load(key); ok {
+			return nil, errors.Errorf("grpc client conn[%s] is already created with client options", c.Endpoint)
+		}
+		conn, err := newConn(c, opts...)
+		if err != nil {
+			return nil, errors.Wrap(err, "GetGRPCClientConn failed")
 		}
+		connMap.Store(key, conn)
+		return conn, nil
+	}
 
-		baseOptions := []kgrpc.ClientOption{
-			kgrpc.WithEndpoint(endpoint),
-			kgrpc.WithTimeout(time.Duration(timeout) * time.Second),
-			kgrpc.WithOptions(
-				grpc.WithIdleTimeout(0), // disable idle timeout
-			),
-			kgrpc.WithPrintDiscoveryDebugLog(false),
+	if conn, ok := connMap.Load(key); ok {
+		return conn.(*grpc.ClientConn), nil
+	}
+	conn, err, _ := sg.Do(key, func() (interface{}, error) {
+		if conn, ok := connMap.Load(key); ok {
+			return conn, nil
+		}
+		conn, err := newConn(c)
+		if err != nil {
+			return nil, err
+		}
+		connMap.Store(key, conn)
+		return conn, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "GetGRPCClientConn failed")
+	}
+	return conn.(*grpc.ClientConn), nil
+}
+
+// newConn dials the grpc client conn of the config, watches its state and warms it up.
+func newConn(c *gconfig.ClientGRPCConfig, opts ...kgrpc.ClientOption) (*grpc.ClientConn, error) {
+	conn, err := dial(c, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go watchConnState(c.Endpoint, conn)
+	if c.Warmup {
+		if err := warmUp(conn, connectTimeout(c)); err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrapf(err, "warmUp[%s] failed", c.Endpoint)
 		}
-		clientOptions := append(baseOptions, opts...)
+	}
+	return conn, nil
+}
 
-		var (
-			conn *grpc.ClientConn
-			err  error
+// dial creates the grpc client conn of the config. The settings of the config take precedence over the client
+// options that set them too, i.e. the endpoint, timeout, TLS and discovery. The interceptors of the client options
+// must be passed through kgrpc.WithOptions, since kgrpc.WithUnaryInterceptor and kgrpc.WithStreamInterceptor
+// would replace the ones of the config.
+func dial(c *gconfig.ClientGRPCConfig, opts ...kgrpc.ClientOption) (*grpc.ClientConn, error) {
+	if err := checkBalancer(c.Balancer); err != nil {
+		return nil, errors.Wrap(err, "checkBalancer failed")
+	}
+	for _, opt := range opts {
+		if setsInterceptors(opt) {
+			return nil, errors.New("kgrpc.WithUnaryInterceptor and kgrpc.WithStreamInterceptor are not supported, " +
+				"pass the interceptors through kgrpc.WithOptions")
+		}
+	}
+
+	selection := &nodeSelection{balancer: c.Balancer, filters: nodeFilters(c.NodeFilter)}
+	clientOptions := []kgrpc.ClientOption{
+		kgrpc.WithOptions(grpc.WithIdleTimeout(0)), // disable idle timeout, the dial options of opts come instead
+	}
+	clientOptions = append(clientOptions, opts...)
+	clientOptions = append(clientOptions,
+		kgrpc.WithEndpoint(c.Endpoint),
+		kgrpc.WithTimeout(0), // the timeouts are applied by ClientTimeout per operation.
+		kgrpc.WithUnaryInterceptor(
+			fallbackInterceptor,
+			unaryClientInterceptor(configMiddlewares(c)...),
+			hedgeInterceptor(c),
+			unaryClientInterceptor(attemptMiddlewares(c)...),
+			selectionInterceptor(selection),
+		),
+		kgrpc.WithStreamInterceptor(streamSelectionInterceptor(selection)),
+	)
+	if strings.HasPrefix(c.Endpoint, discoveryScheme+":") {
+		d, err := getDiscovery()
+		if err != nil {
+			return nil, errors.Wrap(err, "getDiscovery failed")
+		}
+		clientOptions = append(clientOptions,
+			kgrpc.WithDiscovery(&connectDiscovery{Discovery: d, timeout: connectTimeout(c)}),
+			kgrpc.WithPrintDiscoveryDebugLog(false),
 		)
-		if tls {
-			clientOptions = append(clientOptions, kgrpc.WithTLSConfig(&ctls.Config{}))
-			conn, err = kgrpc.Dial(context.Background(), clientOptions...)
-			if err != nil {
-				return nil, errors.Wrap(err, "grpc.Dial failed")
+	}
+
+	if c.TLS.Enabled() {
+		tlsConfig, err := NewClientTLSConfig(c.TLS)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewClientTLSConfig failed")
+		}
+		clientOptions = append(clientOptions, kgrpc.WithTLSConfig(tlsConfig))
+		conn, err := kgrpc.Dial(context.Background(), clientOptions...)
+		if err != nil {
+			return nil, errors.Wrap(err, "grpc.Dial failed")
+		}
+		return conn, nil
+	}
+	conn, err := kgrpc.DialInsecure(context.Background(), clientOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "grpc.DialInsecure failed")
+	}
+	return conn, nil
+}
+
+// setsInterceptors reports whether the kratos client option sets the interceptors of the client, the option
+// is applied to blank kratos client options to find out.
+func setsInterceptors(opt kgrpc.ClientOption) bool {
+	o := reflect.New(reflect.TypeOf(opt).In(0).Elem())
+	reflect.ValueOf(opt).Call([]reflect.Value{o})
+	for _, name := range []string{"ints", "streamInts"} {
+		if f := o.Elem().FieldByName(name); f.IsValid() && f.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// connectDiscovery bounds the creation of the watchers by the connect timeout. The kratos resolver bounds it by
+// the timeout of the client, which is disabled, see dial.
+type connectDiscovery struct {
+	kregistry.Discovery
+	timeout time.Duration
+}
+
+// Watch creates a watcher of the service, the watcher created after the timeout is stopped.
+func (d *connectDiscovery) Watch(ctx context.Context, serviceName string) (kregistry.Watcher, error) {
+	type result struct {
+		w   kregistry.Watcher
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		w, err := d.Discovery.Watch(ctx, serviceName)
+		done <- result{w: w, err: err}
+	}()
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.w, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-done; r.w != nil {
+				_ = r.w.Stop()
 			}
-		} else {
-			conn, err = kgrpc.DialInsecure(context.Background(), clientOptions...)
-			if err != nil {
-				return nil, errors.Wrap(err, "grpc.DialInsecure failed")
+		}()
+		return nil, errors.Errorf("watch[%s] timed out after %s", serviceName, d.timeout)
+	}
+}
+
+// configMiddlewares returns the client middlewares driven by the client config that see one call however many
+// attempts are made.
+func configMiddlewares(c *gconfig.ClientGRPCConfig) []middleware.Middleware {
+	return []middleware.Middleware{connBreaker(c), ClientRetry(c)}
+}
+
+// attemptMiddlewares returns the client middlewares driven by the client config that see every attempt of a call,
+// i.e. the retries and the hedged attempts. The breaker comes before them, so that the rejected requests do not
+// wait for the limits, and the timeout comes before the limits, so that it bounds the wait.
+func attemptMiddlewares(c *gconfig.ClientGRPCConfig) []middleware.Middleware {
+	return []middleware.Middleware{ClientTimeout(c), ClientLimit(c)}
+}
+
+// unaryClientInterceptor adapts the middlewares into a gRPC unary client interceptor. It runs inside the
+// middlewares of the kratos client (see kgrpc.WithMiddleware).
+func unaryClientInterceptor(ms ...middleware.Middleware) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		h := func(ctx context.Context, req any) (any, error) {
+			// the breakers among the middlewares pass the reply of their fallback, see reject.
+			if ok, err := replyFallback(ctx, reply); ok {
+				return reply, err
 			}
+			return reply, invoker(ctx, method, req, reply, cc, opts...)
 		}
+		_, err := middleware.Chain(ms...)(h)(ctx, req)
+		return err
+	}
+}
 
-		log.Println("Connecting at", endpoint)
-		connMap.Store(endpoint, conn)
-		return conn, nil
-	})
-	if err != nil {
-		return nil, errors.Wrap(err, "GetGRPCClientConn failed")
+// SetDiscovery sets the service discovery used to resolve the "discovery:///<service>" endpoints,
+// the Kubernetes discovery is created on first use if not set. It fails once a discovery endpoint has been dialed.
+func SetDiscovery(d kregistry.Discovery) error {
+	if d == nil {
+		return errors.New("discovery is nil")
+	}
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	if discoveryUsed {
+		return errors.New("discovery is already in use")
+	}
+	discovery = d
+	return nil
+}
+
+// getDiscovery returns the service discovery, the Kubernetes discovery is created if it is not set.
+func getDiscovery() (kregistry.Discovery, error) {
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	if discovery == nil {
+		d, err := registry.NewKubeDiscovery()
+		if err != nil {
+			return nil, errors.Wrap(err, "registry.NewKubeDiscovery failed")
+		}
+		discovery = d
 	}
-	return c.(*grpc.ClientConn), nil
+	discoveryUsed = true
+	return discovery, nil
 }
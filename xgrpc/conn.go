@@ -0,0 +1,131 @@
+package xgrpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/utils/gjson"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// defaultConnectTimeout default timeout of the connection warm-up.
+const defaultConnectTimeout = 5 * time.Second
+
+// connStateGauge number of the cached client connections in each connectivity state.
+var connStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "grpc_client_connections",
+	Help: "The number of cached gRPC client connections by connectivity state.",
+}, []string{"target", "state"})
+
+func init() {
+	prometheus.MustRegister(connStateGauge)
+}
+
+// ConnInfo information of a cached client connection.
+type ConnInfo struct {
+	Target string
+	State  connectivity.State
+}
+
+// Conns returns the information of the cached client connections.
+func Conns() []ConnInfo {
+	var infos []ConnInfo
+	connMap.Range(func(_, value any) bool {
+		conn := value.(*grpc.ClientConn)
+		infos = append(infos, ConnInfo{Target: conn.Target(), State: conn.GetState()})
+		return true
+	})
+	return infos
+}
+
+// CloseAll closes and removes all the cached client connections, e.g. after the app stops.
+func CloseAll() error {
+	var errs []error
+	connMap.Range(func(key, value any) bool {
+		connMap.Delete(key)
+		conn := value.(*grpc.ClientConn)
+		if err := conn.Close(); err != nil {
+			errs = append(errs, errors.Wrapf(err, "close[%s] failed", conn.Target()))
+		}
+		return true
+	})
+	return errors.Join(errs...)
+}
+
+// connKey returns the cache key of the client connection: the name and the fingerprint of the config. The
+// connections dialed with client options are kept apart from the others, see GetGRPCClientConnByConfig.
+func connKey(c *gconfig.ClientGRPCConfig, withOptions bool) string {
+	return fmt.Sprintf("%s|%t|%s", c.Name(), withOptions, connFingerprint(c))
+}
+
+// connFingerprint returns the fingerprint of the config the connection is dialed with. The timeouts of
+// the named configs are left out, ClientTimeout follows their changes without a new connection.
+func connFingerprint(c *gconfig.ClientGRPCConfig) string {
+	if c.Name() == "" {
+		return gjson.MustMarshalToString(c)
+	}
+	cc := *c
+	cc.Timeout = 0
+	cc.Methods = make(map[string]*gconfig.MethodConfig, len(c.Methods))
+	for operation, m := range c.Methods {
+		if m != nil {
+			mc := *m
+			mc.Timeout = 0
+			m = &mc
+		}
+		cc.Methods[operation] = m
+	}
+	return gjson.MustMarshalToString(cc)
+}
+
+// connectTimeout returns the timeout of the connection warm-up.
+func connectTimeout(c *gconfig.ClientGRPCConfig) time.Duration {
+	if c.ConnectTimeout > 0 {
+		return time.Duration(c.ConnectTimeout) * time.Second
+	}
+	return defaultConnectTimeout
+}
+
+// warmUp connects eagerly and waits until the connection is ready or the timeout expires.
+func warmUp(conn *grpc.ClientConn, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return errors.Wrapf(ctx.Err(), "connection is %s", state)
+		}
+	}
+	return nil
+}
+
+// watchConnState tracks the connectivity state of the connection in the gauge and logs the transitions,
+// it returns when the connection is closed.
+func watchConnState(target string, conn *grpc.ClientConn) {
+	state := conn.GetState()
+	connStateGauge.WithLabelValues(target, state.String()).Inc()
+	log.Infow(log.DefaultMessageKey, "grpc client connecting", "target", target, "state", state.String())
+
+	for conn.WaitForStateChange(context.Background(), state) {
+		next := conn.GetState()
+		connStateGauge.WithLabelValues(target, state.String()).Dec()
+		level := log.LevelInfo
+		if next == connectivity.TransientFailure {
+			level = log.LevelWarn
+		}
+		log.Log(level, log.DefaultMessageKey, "grpc client connection state changed",
+			"target", target, "from", state.String(), "to", next.String())
+		if next == connectivity.Shutdown {
+			return
+		}
+		connStateGauge.WithLabelValues(target, next.String()).Inc()
+		state = next
+	}
+}
@@ -0,0 +1,20 @@
+package xgrpc
+
+import (
+	"google.golang.org/grpc/health"
+)
+
+// healthServer health service of the servers created by NewGRPCServer.
+var healthServer = health.NewServer()
+
+// HealthServer returns the health service of the servers created by NewGRPCServer, the services can set
+// their own serving statuses on it.
+func HealthServer() *health.Server {
+	return healthServer
+}
+
+// ShutdownHealth sets all the serving statuses to NOT_SERVING and ignores the later updates, so that the probes
+// and load balancers drain the traffic while the servers stop, see NewApp.
+func ShutdownHealth() {
+	healthServer.Shutdown()
+}
@@ -0,0 +1,246 @@
+package xgrpc
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/selector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultHedgeMaxAttempts = 2
+	defaultHedgeDelay       = 100 * time.Millisecond
+	// hedgeLatencyWindow number of the recent latencies used to compute the percentile.
+	hedgeLatencyWindow = 128
+	// hedgeMinSamples minimum number of the latencies before the percentile is used.
+	hedgeMinSamples = 20
+)
+
+const (
+	hedgeResultHedged = "hedged"
+	hedgeResultWon    = "won"
+)
+
+// hedgeCounter number of the hedged attempts sent and the hedged attempts that won.
+var hedgeCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_client_hedges_total",
+	Help: "The total number of gRPC client hedged attempts by result.",
+}, []string{"target", "operation", "result"})
+
+func init() {
+	prometheus.MustRegister(hedgeCounter)
+}
+
+// hedgeInterceptor is a unary client interceptor that hedges the operations configured with a hedging policy.
+// The hedged attempts exclude the instances already tried.
+func hedgeInterceptor(c *gconfig.ClientGRPCConfig) grpc.UnaryClientInterceptor {
+	policies := make(map[string]*hedgePolicy)
+	for operation, m := range c.Methods {
+		if m != nil && m.Hedge != nil {
+			policies[operation] = newHedgePolicy(c.Endpoint, operation, m.Hedge)
+		}
+	}
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := policies[method]
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if _, ok := reply.(proto.Message); !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return policy.invoke(ctx, method, req, reply.(proto.Message), cc, invoker, opts...)
+	}
+}
+
+// hedgePolicy hedging policy of an operation.
+type hedgePolicy struct {
+	target      string
+	operation   string
+	maxAttempts int
+	delay       time.Duration
+	percentile  float64
+	latencies   *latencyWindow
+}
+
+// newHedgePolicy creates the hedging policy from the config.
+func newHedgePolicy(target, operation string, c *gconfig.HedgeConfig) *hedgePolicy {
+	p := &hedgePolicy{
+		target:      target,
+		operation:   operation,
+		maxAttempts: defaultHedgeMaxAttempts,
+		delay:       defaultHedgeDelay,
+		percentile:  c.Percentile,
+		latencies:   &latencyWindow{},
+	}
+	if c.MaxAttempts > 0 {
+		p.maxAttempts = c.MaxAttempts
+	}
+	if c.Delay > 0 {
+		p.delay = c.Delay.Duration()
+	}
+	return p
+}
+
+// hedgeResult result of a hedged attempt.
+type hedgeResult struct {
+	attempt int
+	reply   proto.Message
+	peer    *selector.Peer
+	latency time.Duration
+	err     error
+}
+
+// invoke sends the attempts until one succeeds, a non-retryable error is returned or all attempts fail.
+// The losing attempts are cancelled when invoke returns.
+func (p *hedgePolicy) invoke(ctx context.Context, method string, req any, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tried := &triedNodes{}
+	results := make(chan hedgeResult, p.maxAttempts)
+	send := func(attempt int) {
+		// every attempt has its own reply and peer, so that the concurrent attempts do not race.
+		r := reply.ProtoReflect().New().Interface()
+		pr := &selector.Peer{}
+		actx := selector.NewPeerContext(context.WithValue(ctx, triedNodesKey{}, tried), pr)
+		go func() {
+			startTime := time.Now()
+			err := invoker(actx, method, req, r, cc, opts...)
+			results <- hedgeResult{attempt: attempt, reply: r, peer: pr, latency: time.Since(startTime), err: err}
+		}()
+	}
+
+	send(1)
+	sent, failed := 1, 0
+	timer := time.NewTimer(p.nextDelay())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if sent < p.maxAttempts && ctx.Err() == nil {
+				sent++
+				send(sent)
+				hedgeCounter.WithLabelValues(p.target, p.operation, hedgeResultHedged).Inc()
+				timer.Reset(p.nextDelay())
+			}
+		case res := <-results:
+			// the breakers keyed by endpoint see every attempt instead of the peer of the call, see breakByEndpoint.
+			if nb, ok := ctx.Value(nodeBreakersKey{}).(*nodeBreakers); ok && res.peer.Node != nil {
+				nb.markAttempt(res.peer.Node.Address(), res.err)
+			}
+			if res.err == nil {
+				p.latencies.observe(res.latency)
+				if res.attempt > 1 {
+					hedgeCounter.WithLabelValues(p.target, p.operation, hedgeResultWon).Inc()
+				}
+				setPeer(ctx, res.peer)
+				proto.Merge(reply, res.reply)
+				return nil
+			}
+			failed++
+			if !status.IsRetryable(res.err) || ctx.Err() != nil {
+				setPeer(ctx, res.peer)
+				return res.err
+			}
+			// a retryable failure sends the next attempt at once, unless the limits rejected it, see ClientLimit.
+			if sent < p.maxAttempts && status.Code(res.err) != ecodes.TooManyRequests {
+				sent++
+				send(sent)
+				hedgeCounter.WithLabelValues(p.target, p.operation, hedgeResultHedged).Inc()
+				timer.Reset(p.nextDelay())
+			} else if failed == sent {
+				setPeer(ctx, res.peer)
+				return res.err
+			}
+		}
+	}
+}
+
+// setPeer sets the node of the attempt that decided the result on the peer of the call.
+func setPeer(ctx context.Context, pr *selector.Peer) {
+	if p, ok := selector.FromPeerContext(ctx); ok {
+		p.Node = pr.Node
+	}
+}
+
+// nextDelay returns the delay before the next attempt.
+func (p *hedgePolicy) nextDelay() time.Duration {
+	if p.percentile > 0 {
+		if d, ok := p.latencies.percentile(p.percentile); ok {
+			return d
+		}
+	}
+	return p.delay
+}
+
+// latencyWindow recent latencies of the successful attempts.
+type latencyWindow struct {
+	mu        sync.Mutex
+	latencies [hedgeLatencyWindow]time.Duration
+	count     int
+}
+
+// observe records the latency.
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.latencies[w.count%hedgeLatencyWindow] = d
+	w.count++
+}
+
+// percentile returns the latency percentile, it is false until enough latencies are observed.
+func (w *latencyWindow) percentile(q float64) (time.Duration, bool) {
+	w.mu.Lock()
+	n := min(w.count, hedgeLatencyWindow)
+	if n < hedgeMinSamples {
+		w.mu.Unlock()
+		return 0, false
+	}
+	latencies := slices.Clone(w.latencies[:n])
+	w.mu.Unlock()
+
+	slices.Sort(latencies)
+	return latencies[int(q*float64(n-1))], true
+}
+
+// triedNodesKey context key of the nodes tried by the hedged attempts.
+type triedNodesKey struct{}
+
+// triedNodes addresses of the nodes tried by the hedged attempts of a call.
+type triedNodes struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+// add records the address of the tried node.
+func (t *triedNodes) add(addr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !slices.Contains(t.addrs, addr) {
+		t.addrs = append(t.addrs, addr)
+	}
+}
+
+// filter is a node filter that excludes the tried nodes, all nodes are kept if every node has been tried.
+func (t *triedNodes) filter(_ context.Context, nodes []selector.Node) []selector.Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	newNodes := make([]selector.Node, 0, len(nodes))
+	for _, n := range nodes {
+		if !slices.Contains(t.addrs, n.Address()) {
+			newNodes = append(newNodes, n)
+		}
+	}
+	if len(newNodes) == 0 {
+		return nodes
+	}
+	return newNodes
+}
@@ -0,0 +1,211 @@
+package xgrpc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/utils/group"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	limitReasonConcurrency = "concurrency"
+	limitReasonRate        = "rate"
+)
+
+var (
+	// limitInflightGauge number of the in-flight requests of the limiters.
+	limitInflightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_client_limit_inflight",
+		Help: "The number of gRPC client in-flight requests by target and limited operation.",
+	}, []string{"target", "operation"})
+
+	// limitRejectionCounter number of the requests rejected by the limiters.
+	limitRejectionCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_limit_rejections_total",
+		Help: "The total number of gRPC client requests rejected by the client limits by target, operation and reason.",
+	}, []string{"target", "operation", "reason"})
+)
+
+func init() {
+	prometheus.MustRegister(limitInflightGauge, limitRejectionCounter)
+}
+
+// ClientLimit is a client middleware that limits the in-flight requests and the request rate of the downstream,
+// or of every operation if the limit config is per operation. The operations with their own limit config have
+// their own limits. A request waits for the limits up to the max wait, and is rejected with TooManyRequests then.
+// A request whose context is done while waiting fails with the error of the context instead.
+// The connections created by this package apply the limits to every attempt, including the retries and the hedged
+// attempts, see attemptMiddlewares.
+func ClientLimit(c *gconfig.ClientGRPCConfig) middleware.Middleware {
+	limiters := make(map[string]*limiter, len(c.Methods))
+	for operation, m := range c.Methods {
+		if m != nil && m.Limit != nil {
+			limiters[operation] = newLimiter(m.Limit)
+		}
+	}
+	var (
+		shared *limiter
+		gp     *group.Group[*limiter]
+	)
+	if c.Limit != nil {
+		if c.Limit.PerOperation {
+			gp = group.NewGroup(func() *limiter {
+				return newLimiter(c.Limit)
+			})
+		} else {
+			shared = newLimiter(c.Limit)
+		}
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var operation string
+			if info, ok := transport.FromClientContext(ctx); ok {
+				operation = info.Operation()
+			}
+
+			// label is the operation of the limiter, it is empty for the limiter of the downstream.
+			var (
+				l     *limiter
+				label = operation
+			)
+			switch {
+			case limiters[operation] != nil:
+				l = limiters[operation]
+			case gp != nil:
+				l = gp.Get(operation)
+			case shared != nil:
+				l, label = shared, ""
+			default:
+				return handler(ctx, req)
+			}
+
+			release, reason, err := l.acquire(ctx)
+			if err != nil {
+				return nil, status.Convert(ctx, err)
+			}
+			if reason != "" {
+				limitRejectionCounter.WithLabelValues(c.Endpoint, label, reason).Inc()
+				return nil, status.Error(ctx, ecodes.TooManyRequests, errors.Errorf("client %s limit of %s exceeded", reason, c.Endpoint))
+			}
+			inflight := limitInflightGauge.WithLabelValues(c.Endpoint, label)
+			inflight.Inc()
+			defer func() {
+				inflight.Dec()
+				release()
+			}()
+			return handler(ctx, req)
+		}
+	}
+}
+
+// limiter limits the in-flight requests by a semaphore and the request rate by a token bucket.
+type limiter struct {
+	sem     *semaphore.Weighted
+	bucket  *tokenBucket
+	maxWait time.Duration
+}
+
+// newLimiter creates the limiter of the config, the unset limits are unlimited.
+func newLimiter(c *gconfig.LimitConfig) *limiter {
+	l := &limiter{maxWait: c.MaxWait.Duration()}
+	if c.MaxConcurrency > 0 {
+		l.sem = semaphore.NewWeighted(c.MaxConcurrency)
+	}
+	if c.Rate > 0 {
+		burst := float64(c.Burst)
+		if burst <= 0 {
+			burst = math.Max(math.Ceil(c.Rate), 1)
+		}
+		l.bucket = &tokenBucket{rate: c.Rate, burst: burst, tokens: burst, last: time.Now()}
+	}
+	return l
+}
+
+// acquire waits for the limits up to the max wait, it returns the release function of the request, the reason of
+// the rejection if the limits are exceeded, or the error of ctx if it is done while waiting. The token taken from
+// the bucket is given back if the request does not go through.
+func (l *limiter) acquire(ctx context.Context) (func(), string, error) {
+	deadline := time.Now().Add(l.maxWait)
+	if l.bucket != nil {
+		wait, ok := l.bucket.reserve(l.maxWait)
+		if !ok {
+			return nil, limitReasonRate, nil
+		}
+		if wait > 0 && !sleep(ctx, wait) {
+			l.bucket.giveBack()
+			return nil, "", ctx.Err()
+		}
+	}
+	if l.sem == nil {
+		return func() {}, "", nil
+	}
+	if !l.sem.TryAcquire(1) {
+		if l.maxWait <= 0 {
+			l.giveBack()
+			return nil, limitReasonConcurrency, nil
+		}
+		wctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		if err := l.sem.Acquire(wctx, 1); err != nil {
+			l.giveBack()
+			if ctx.Err() != nil {
+				return nil, "", ctx.Err()
+			}
+			return nil, limitReasonConcurrency, nil
+		}
+	}
+	return func() { l.sem.Release(1) }, "", nil
+}
+
+// giveBack gives the token back to the bucket if the limiter has one.
+func (l *limiter) giveBack() {
+	if l.bucket != nil {
+		l.bucket.giveBack()
+	}
+}
+
+// tokenBucket token bucket refilled at the rate up to the burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token, it returns how long to wait until the token is available, and false without taking
+// the token if the wait exceeds maxWait.
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	if wait > maxWait {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// giveBack returns a token taken by reserve that was not used.
+func (b *tokenBucket) giveBack() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
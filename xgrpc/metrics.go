@@ -0,0 +1,51 @@
+package xgrpc
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+)
+
+var (
+	// clientRequestCounter number of the client requests.
+	clientRequestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_requests_total",
+		Help: "The total number of gRPC client requests by target, operation and business code.",
+	}, []string{"target", "operation", "code"})
+
+	// clientLatencyHistogram latency of the client requests.
+	clientLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_client_handling_seconds",
+		Help:    "Histogram of the gRPC client request latency by target, operation and business code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"target", "operation", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(clientRequestCounter, clientLatencyHistogram)
+}
+
+// ClientMetrics is a client middleware that records the requests and latency labeled by the target,
+// the operation and the business code.
+func ClientMetrics() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var target, operation string
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				target = tr.Endpoint()
+				operation = tr.Operation()
+			}
+			startTime := time.Now()
+			reply, err := handler(ctx, req)
+			code := strconv.FormatUint(uint64(status.Code(err)), 10)
+			clientRequestCounter.WithLabelValues(target, operation, code).Inc()
+			clientLatencyHistogram.WithLabelValues(target, operation, code).Observe(time.Since(startTime).Seconds())
+			return reply, err
+		}
+	}
+}
@@ -3,26 +3,30 @@ package xgrpc
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
+	"reflect"
 	"runtime"
 	"strings"
 	"time"
 
-	"github.com/go-kratos/aegis/circuitbreaker"
-	"github.com/go-kratos/aegis/circuitbreaker/sre"
 	"github.com/go-kratos/aegis/ratelimit"
 	"github.com/go-kratos/aegis/ratelimit/bbr"
-	kerrors "github.com/go-kratos/kratos/v2/errors"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/metadata"
 	"github.com/go-kratos/kratos/v2/middleware/tracing"
+	"github.com/go-kratos/kratos/v2/selector"
 	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	zhtranslations "github.com/go-playground/validator/v10/translations/zh"
+	"github.com/samber/lo"
 	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/errors"
 	"github.com/yearm/kratos-pkg/logger"
 	"github.com/yearm/kratos-pkg/utils/bytesconv"
 	"github.com/yearm/kratos-pkg/utils/gjson"
-	"github.com/yearm/kratos-pkg/utils/group"
 	"github.com/yearm/kratos-pkg/xgrpc/status"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -35,36 +39,96 @@ var (
 		tracing.Server(),
 		metadata.Server(),
 		Log(),
+		Status(),
 		Recovery(),
 		RateLimit(),
 		Validator(),
 	}
 
-	// DefaultClientMiddlewares default middleware chain for clients.
+	// DefaultClientMiddlewares default middleware chain for clients, see NewClientMiddlewares for the optional ones.
+	// The connections created by this package install the circuit breaker, see ClientBreaker.
 	DefaultClientMiddlewares = []middleware.Middleware{
 		tracing.Client(),
 		metadata.Client(),
 		Recovery(),
-		ClientBreaker(),
 	}
 )
 
+// ClientMiddlewareOption client middleware option.
+type ClientMiddlewareOption func(*clientMiddlewareOptions)
+
+// clientMiddlewareOptions client middleware options.
+type clientMiddlewareOptions struct {
+	tracingOptions []tracing.Option
+	logEnabled     bool
+	logSampling    float64
+	metricsEnabled bool
+	breakerEnabled bool
+	breakerOptions []BreakerOption
+}
+
+// WithClientMiddlewareTracingOptions used to set the tracing.Client options.
+func WithClientMiddlewareTracingOptions(tracingOpts []tracing.Option) ClientMiddlewareOption {
+	return func(options *clientMiddlewareOptions) {
+		options.tracingOptions = tracingOpts
+	}
+}
+
+// WithClientMiddlewareLog used to enable the ClientLog with the sampling rate of successful calls.
+func WithClientMiddlewareLog(sampling float64) ClientMiddlewareOption {
+	return func(options *clientMiddlewareOptions) {
+		options.logEnabled = true
+		options.logSampling = sampling
+	}
+}
+
+// WithClientMiddlewareMetrics used to enable the ClientMetrics.
+func WithClientMiddlewareMetrics() ClientMiddlewareOption {
+	return func(options *clientMiddlewareOptions) {
+		options.metricsEnabled = true
+	}
+}
+
+// WithClientMiddlewareBreaker used to enable the ClientBreaker with the options, e.g. for the connections not created
+// by this package. On the connections created by this package it takes the place of the breaker of the client config.
+func WithClientMiddlewareBreaker(breakerOpts ...BreakerOption) ClientMiddlewareOption {
+	return func(options *clientMiddlewareOptions) {
+		options.breakerEnabled = true
+		options.breakerOptions = breakerOpts
+	}
+}
+
+// NewClientMiddlewares creates the middleware chain for clients like DefaultClientMiddlewares,
+// ClientLog, ClientMetrics and ClientBreaker are enabled by options.
+func NewClientMiddlewares(opts ...ClientMiddlewareOption) []middleware.Middleware {
+	opt := clientMiddlewareOptions{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	ms := []middleware.Middleware{
+		tracing.Client(opt.tracingOptions...),
+		metadata.Client(),
+	}
+	if opt.metricsEnabled {
+		ms = append(ms, ClientMetrics())
+	}
+	if opt.logEnabled {
+		ms = append(ms, ClientLog(opt.logSampling))
+	}
+	ms = append(ms, Recovery())
+	if opt.breakerEnabled {
+		ms = append(ms, ClientBreaker(opt.breakerOptions...))
+	}
+	return ms
+}
+
 // Recovery is a recovery middleware.
 func Recovery() middleware.Middleware {
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req any) (reply any, err error) {
 			defer func() {
 				if e := recover(); e != nil {
-					buf := make([]byte, 64<<10)
-					n := runtime.Stack(buf, false)
-					errString := fmt.Sprintf("%v", e)
-					errInfo := gjson.MustMarshalToString(map[string]any{
-						"error": errString,
-						"req":   fmt.Sprintf("%+v", req),
-						"stack": fmt.Sprintf("%s", buf[:n]),
-					})
-					log.Context(ctx).Error(errInfo)
-					err = status.Error(ctx, ecodes.InternalServerError, fmt.Errorf(errString))
+					err = recoveredError(ctx, e, req)
 				}
 			}()
 			return handler(ctx, req)
@@ -72,6 +136,35 @@ func Recovery() middleware.Middleware {
 	}
 }
 
+// recoveredError logs the recovered panic with the request and stack, and returns its status error.
+func recoveredError(ctx context.Context, e any, req any) error {
+	buf := make([]byte, 64<<10)
+	n := runtime.Stack(buf, false)
+	errString := fmt.Sprintf("%v", e)
+	errInfo := gjson.MustMarshalToString(map[string]any{
+		"error": errString,
+		"req":   fmt.Sprintf("%+v", req),
+		"stack": fmt.Sprintf("%s", buf[:n]),
+	})
+	log.Context(ctx).Error(errInfo)
+	info := errors.RecoveredCode(e)
+	return status.Error(ctx, info.Code, fmt.Errorf(errString), status.WithCodeInfo(info))
+}
+
+// Status is a middleware that converts the errors returned by handlers into gRPC status errors,
+// errors bound with a code by errors.WithCode are converted with the bound code.
+func Status() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			reply, err := handler(ctx, req)
+			if err != nil {
+				return reply, status.Convert(ctx, err)
+			}
+			return reply, nil
+		}
+	}
+}
+
 // RateLimit is a server rate limiter middleware
 func RateLimit(opts ...bbr.Option) middleware.Middleware {
 	limiter := bbr.NewLimiter(opts...)
@@ -108,38 +201,91 @@ func Log() middleware.Middleware {
 
 			reply, err = handler(ctx, req)
 
-			level := log.LevelInfo
-			responseLog := logger.ResponseLog{
-				Code:  uint32(ecodes.OK),
-				Reply: protoToString(reply),
+			level, responseLog := newResponseLog(reply, err, time.Since(startTime))
+			keyvals := []any{
+				log.DefaultMessageKey, "",
+				logger.RequestKey, requestLog,
+				logger.ResponseKey, responseLog,
 			}
-			st, detail, ok := status.FromError(err)
-			if ok {
-				responseLog.Code = uint32(st.Code())
-				responseLog.Error = st.Message()
-				if detail != nil {
-					errorDetail := status.ToErrorDetail(detail)
-					level = errorDetail.Level
-					responseLog.ErrorDetail = &logger.ErrorDetailLog{
-						Code:    uint32(errorDetail.Code),
-						Message: errorDetail.Message,
-						Level:   strings.ToLower(errorDetail.Level.String()),
-						Callers: errorDetail.Callers,
-					}
-				}
+			log.Context(ctx).Log(level, append(keyvals, logger.FieldKeyvals(status.Fields(err))...)...)
+			return
+		}
+	}
+}
+
+// ClientLog is a client logging middleware, failed calls are always logged and successful calls are sampled
+// at the sampling rate, e.g. 0.1 logs 10% of them.
+func ClientLog(sampling float64) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (reply any, err error) {
+			startTime := time.Now()
+			reply, err = handler(ctx, req)
+			if err == nil && rand.Float64() >= sampling {
+				return
 			}
-			responseLog.Latency = time.Since(startTime).Milliseconds()
 
-			log.Context(ctx).Log(level,
+			var requestLog logger.RequestLog
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				requestLog.Kind = tr.Kind().String()
+				requestLog.Endpoint = tr.Endpoint()
+				requestLog.Method = tr.Operation()
+				requestLog.Header = gjson.MustMarshalToString(tr.RequestHeader())
+				requestLog.Req = protoToString(req)
+			}
+			if p, ok := selector.FromPeerContext(ctx); ok && p.Node != nil {
+				requestLog.Peer = p.Node.Address()
+			}
+
+			// the reply of a failed call is an empty message, it is not logged.
+			level, responseLog := newResponseLog(lo.Ternary[any](err == nil, reply, nil), err, time.Since(startTime))
+			keyvals := []any{
 				log.DefaultMessageKey, "",
 				logger.RequestKey, requestLog,
 				logger.ResponseKey, responseLog,
-			)
+			}
+			log.Context(ctx).Log(level, append(keyvals, logger.FieldKeyvals(status.Fields(err))...)...)
 			return
 		}
 	}
 }
 
+// newResponseLog creates the response log of the reply and error, and returns the log level of the error.
+func newResponseLog(reply any, err error, latency time.Duration) (log.Level, logger.ResponseLog) {
+	level := log.LevelInfo
+	responseLog := logger.ResponseLog{
+		Code:  uint32(ecodes.OK),
+		Reply: protoToString(reply),
+	}
+	st, detail, ok := status.ParseError(err)
+	if ok {
+		responseLog.Code = uint32(st.Code())
+		responseLog.Error = st.Message()
+		level = ecodes.FromGRPCCode(st.Code()).Level()
+		if detail != nil {
+			level = detail.Level
+			responseLog.ErrorDetail = &logger.ErrorDetailLog{
+				Code:     uint32(detail.Code),
+				Message:  detail.Message,
+				Level:    strings.ToLower(detail.Level.String()),
+				Severity: logger.SeverityValue(detail.Code.Severity()),
+				Callers:  detail.Callers,
+				Args:     detail.Args,
+				Origin:   detail.OriginService(),
+				Hops:     detail.HopCount(),
+			}
+		}
+	} else if err != nil {
+		responseLog.Code = uint32(ecodes.UnknownError)
+		responseLog.Error = err.Error()
+		level = ecodes.UnknownError.Level()
+	}
+	if level >= log.LevelError {
+		responseLog.Stack = errors.StackTrace(err)
+	}
+	responseLog.Latency = latency.Milliseconds()
+	return level, responseLog
+}
+
 // protoToString convert proto to string.
 func protoToString(m any) string {
 	if v, ok := m.(proto.Message); ok {
@@ -149,40 +295,73 @@ func protoToString(m any) string {
 	return fmt.Sprintf("%+v", m)
 }
 
-// Validator is a validator middleware.
+// Validator is a validator middleware, the validation errors are converted into field-level violations
+// carried in the status detail, with descriptions localized in Simplified Chinese.
 func Validator() middleware.Middleware {
-	validate := validator.New()
+	validate := newValidateFunc()
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req any) (reply any, err error) {
-			if e := validate.StructCtx(ctx, req); e != nil {
-				return nil, status.Error(ctx, ecodes.InvalidArgument, e, status.WithLevel(log.LevelWarn))
+			if err := validate(ctx, req); err != nil {
+				return nil, err
 			}
 			return handler(ctx, req)
 		}
 	}
 }
 
-// ClientBreaker circuit breaker middleware will return ServiceUnavailable when the circuit
-// breaker is triggered and the request is rejected directly.
-func ClientBreaker() middleware.Middleware {
-	gp := group.NewGroup(func() any {
-		return sre.NewBreaker()
-	})
-	return func(handler middleware.Handler) middleware.Handler {
-		return func(ctx context.Context, req any) (any, error) {
-			info, _ := transport.FromClientContext(ctx)
-			breaker := gp.Get(info.Operation()).(circuitbreaker.CircuitBreaker)
-			if err := breaker.Allow(); err != nil {
-				breaker.MarkFailed()
-				return nil, status.Error(ctx, ecodes.ServiceUnavailable, err)
-			}
-			reply, err := handler(ctx, req)
-			if err != nil && (kerrors.IsInternalServer(err) || kerrors.IsServiceUnavailable(err) || kerrors.IsGatewayTimeout(err)) {
-				breaker.MarkFailed()
-			} else {
-				breaker.MarkSuccess()
-			}
-			return reply, err
+// newValidateFunc creates the function validating the requests, it returns the InvalidArgument status error
+// with the violations if a request is invalid.
+func newValidateFunc() func(ctx context.Context, req any) error {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(jsonFieldName)
+	trans, _ := ut.New(zh.New()).GetTranslator("zh")
+	_ = zhtranslations.RegisterDefaultTranslations(validate, trans)
+	return func(ctx context.Context, req any) error {
+		e := validate.StructCtx(ctx, req)
+		if e == nil {
+			return nil
+		}
+		var validationErrors validator.ValidationErrors
+		if errors.As(e, &validationErrors) {
+			violations := lo.Map(validationErrors, func(fe validator.FieldError, _ int) *status.Violation {
+				return &status.Violation{
+					Field:       fieldPath(fe.Namespace()),
+					Rule:        fe.Tag(),
+					Param:       fe.Param(),
+					Description: fe.Translate(trans),
+				}
+			})
+			return status.Error(ctx, ecodes.InvalidArgument, e, status.WithViolations(violations...))
 		}
+		return status.Error(ctx, ecodes.InvalidArgument, e)
+	}
+}
+
+// jsonFieldName returns the JSON name of the struct field, so that the violations use the field names seen by clients.
+// The protobuf JSON name takes precedence over the json tag.
+func jsonFieldName(field reflect.StructField) string {
+	var protoName string
+	for _, part := range strings.Split(field.Tag.Get("protobuf"), ",") {
+		if name, ok := strings.CutPrefix(part, "json="); ok {
+			return name
+		}
+		if name, ok := strings.CutPrefix(part, "name="); ok {
+			protoName = name
+		}
+	}
+	if protoName != "" {
+		return protoName
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// fieldPath trims the root struct name of the validator namespace, e.g. "CreateUserRequest.user.name" to "user.name".
+func fieldPath(namespace string) string {
+	if _, path, ok := strings.Cut(namespace, "."); ok {
+		return path
 	}
+	return namespace
 }
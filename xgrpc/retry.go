@@ -0,0 +1,247 @@
+package xgrpc
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	gstatus "google.golang.org/grpc/status"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 50 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+	defaultRetryMaxTokens      = 10
+	defaultRetryTokenRatio     = 0.1
+)
+
+const (
+	retryResultRetried   = "retried"
+	retryResultThrottled = "throttled"
+	retryResultExhausted = "exhausted"
+)
+
+// retryCounter number of the retry decisions: retried, throttled by the budget or exhausted the attempts.
+var retryCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "grpc_client_retries_total",
+	Help: "The total number of gRPC client retry decisions by result.",
+}, []string{"target", "operation", "code", "result"})
+
+func init() {
+	prometheus.MustRegister(retryCounter)
+}
+
+// ClientRetry is a client middleware that retries the idempotent operations of the client config with exponential
+// backoff and jitter. The retries of all operations are bounded by a token-bucket retry budget of the client.
+func ClientRetry(c *gconfig.ClientGRPCConfig) middleware.Middleware {
+	policies := make(map[string]*retryPolicy, len(c.Methods))
+	for operation, m := range c.Methods {
+		if m == nil || !m.Idempotent {
+			continue
+		}
+		if p := newRetryPolicy(m.Retry, c.Retry); p != nil {
+			policies[operation] = p
+		}
+	}
+	budget := newRetryBudget(c.Retry)
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var operation string
+			if info, ok := transport.FromClientContext(ctx); ok {
+				operation = info.Operation()
+			}
+			policy, ok := policies[operation]
+			if !ok {
+				return handler(ctx, req)
+			}
+
+			for attempt := 1; ; attempt++ {
+				reply, err := handler(ctx, req)
+				if err == nil {
+					budget.onSuccess()
+					return reply, nil
+				}
+				if !policy.retryable(err) || ctx.Err() != nil {
+					return reply, err
+				}
+				budget.onFailure()
+
+				code := strconv.FormatUint(uint64(status.Code(err)), 10)
+				if attempt >= policy.maxAttempts {
+					retryCounter.WithLabelValues(c.Endpoint, operation, code, retryResultExhausted).Inc()
+					return reply, err
+				}
+				if !budget.allow() {
+					retryCounter.WithLabelValues(c.Endpoint, operation, code, retryResultThrottled).Inc()
+					return reply, err
+				}
+				backoff := policy.backoff(attempt)
+				trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+					attribute.Int("retry.attempt", attempt+1),
+					attribute.String("retry.code", code),
+					attribute.String("retry.backoff", backoff.String()),
+				))
+				if !sleep(ctx, backoff) {
+					return reply, err
+				}
+				retryCounter.WithLabelValues(c.Endpoint, operation, code, retryResultRetried).Inc()
+			}
+		}
+	}
+}
+
+// retryPolicy effective retry policy of an operation.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	codes          map[ecodes.Code]struct{}
+	grpcCodes      map[codes.Code]struct{}
+}
+
+// newRetryPolicy creates the retry policy from the first non-nil config, it is nil if retry is not configured.
+func newRetryPolicy(configs ...*gconfig.RetryConfig) *retryPolicy {
+	var c *gconfig.RetryConfig
+	for _, config := range configs {
+		if config != nil {
+			c = config
+			break
+		}
+	}
+	if c == nil {
+		return nil
+	}
+
+	p := &retryPolicy{
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+		multiplier:     defaultRetryMultiplier,
+		jitter:         defaultRetryJitter,
+	}
+	if c.MaxAttempts > 0 {
+		p.maxAttempts = c.MaxAttempts
+	}
+	if c.InitialBackoff > 0 {
+		p.initialBackoff = c.InitialBackoff.Duration()
+	}
+	if c.MaxBackoff > 0 {
+		p.maxBackoff = c.MaxBackoff.Duration()
+	}
+	if c.Multiplier > 0 {
+		p.multiplier = c.Multiplier
+	}
+	if c.Jitter > 0 {
+		p.jitter = math.Min(c.Jitter, 1)
+	}
+	if p.maxAttempts <= 1 {
+		return nil
+	}
+	if len(c.RetryableCodes) > 0 {
+		p.codes = make(map[ecodes.Code]struct{}, len(c.RetryableCodes))
+		for _, code := range c.RetryableCodes {
+			p.codes[ecodes.Code(code)] = struct{}{}
+		}
+	}
+	p.grpcCodes = make(map[codes.Code]struct{}, len(c.RetryableGRPCCodes))
+	for _, name := range c.RetryableGRPCCodes {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(name))); err == nil {
+			p.grpcCodes[code] = struct{}{}
+		}
+	}
+	return p
+}
+
+// retryable reports whether the error is retryable by the gRPC status code or the business code.
+func (p *retryPolicy) retryable(err error) bool {
+	if _, ok := p.grpcCodes[gstatus.Code(err)]; ok {
+		return true
+	}
+	if p.codes == nil {
+		return status.IsRetryable(err)
+	}
+	_, ok := p.codes[status.Code(err)]
+	return ok
+}
+
+// backoff returns the jittered backoff before the retry-th retry.
+func (p *retryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(retry-1))
+	d = math.Min(d, float64(p.maxBackoff))
+	d *= 1 + p.jitter*(rand.Float64()*2-1)
+	return time.Duration(d)
+}
+
+// retryBudget token-bucket retry budget, see gconfig.RetryBudgetConfig.
+type retryBudget struct {
+	mu         sync.Mutex
+	tokens     float64
+	maxTokens  float64
+	tokenRatio float64
+}
+
+// newRetryBudget creates the retry budget of the client.
+func newRetryBudget(c *gconfig.RetryConfig) *retryBudget {
+	b := &retryBudget{maxTokens: defaultRetryMaxTokens, tokenRatio: defaultRetryTokenRatio}
+	if c != nil && c.Budget != nil {
+		if c.Budget.MaxTokens > 0 {
+			b.maxTokens = c.Budget.MaxTokens
+		}
+		if c.Budget.TokenRatio > 0 {
+			b.tokenRatio = c.Budget.TokenRatio
+		}
+	}
+	b.tokens = b.maxTokens
+	return b
+}
+
+// onSuccess returns tokens to the bucket.
+func (b *retryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+b.tokenRatio, b.maxTokens)
+}
+
+// onFailure takes a token from the bucket.
+func (b *retryBudget) onFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(b.tokens-1, 0)
+}
+
+// allow reports whether a retry is allowed by the budget.
+func (b *retryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+// sleep waits for the duration, it returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -7,9 +7,16 @@ import (
 	"github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/yearm/kratos-pkg/config/gconfig"
 	"github.com/yearm/kratos-pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 )
 
-// NewGRPCServer creates a GRPC server.
+// NewGRPCServer creates a GRPC server. The message sizes, stream and keepalive limits of the config
+// are set by kgrpc.Options, which is replaced by kgrpc.Options of opts. The health service reports the
+// statuses of HealthServer, and the reflection service is registered by default only if the mode is set and is not production.
+// The streaming RPCs are logged, recovered and validated by the stream interceptors, which are replaced by
+// kgrpc.StreamInterceptor of opts.
 func NewGRPCServer(opts ...kgrpc.ServerOption) (*kgrpc.Server, error) {
 	c, err := gconfig.GetServerGRPCConfig()
 	if err != nil {
@@ -17,15 +24,75 @@ func NewGRPCServer(opts ...kgrpc.ServerOption) (*kgrpc.Server, error) {
 	}
 	baseOptions := []kgrpc.ServerOption{
 		kgrpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
-		kgrpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
+		kgrpc.StreamInterceptor(
+			grpc_prometheus.StreamServerInterceptor,
+			StreamLog(c.StreamMessageLog),
+			StreamRecovery(),
+			StreamValidator(),
+		),
 		kgrpc.Address(fmt.Sprintf("%s:%d", c.Host, c.Port)),
-		kgrpc.Timeout(0), // Setting timeout to 0 delegates timeout control to client's context.
+		kgrpc.Timeout(c.Timeout.Duration()), // 0 delegates timeout control to client's context.
+		kgrpc.Options(serverOptions(c)...),
+	}
+	if c.TLS.Enabled() {
+		tlsConfig, err := NewServerTLSConfig(c.TLS)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewServerTLSConfig failed")
+		}
+		baseOptions = append(baseOptions, kgrpc.TLSConfig(tlsConfig))
+	}
+	// the health service of kratos cannot be reached by the app lifecycle, so it is replaced by healthServer.
+	baseOptions = append(baseOptions, kgrpc.CustomHealth())
+	if !reflectionEnabled(c) {
+		baseOptions = append(baseOptions, kgrpc.DisableReflection())
+	}
+	srv := kgrpc.NewServer(append(baseOptions, opts...)...)
+	if c.Health == nil || *c.Health {
+		grpc_health_v1.RegisterHealthServer(srv.Server, healthServer)
 	}
-	serverOptions := append(baseOptions, opts...)
-	srv := kgrpc.NewServer(serverOptions...)
 	if c.EnableHandlingTimeHistogram {
 		grpc_prometheus.EnableHandlingTimeHistogram()
 	}
 	grpc_prometheus.Register(srv.Server)
 	return srv, nil
 }
+
+// serverOptions returns the grpc server options of the config.
+func serverOptions(c *gconfig.ServerGRPCConfig) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(c.MaxConcurrentStreams))
+	}
+	if k := c.Keepalive; k != nil {
+		opts = append(opts,
+			grpc.KeepaliveParams(keepalive.ServerParameters{
+				MaxConnectionIdle:     k.MaxConnectionIdle.Duration(),
+				MaxConnectionAge:      k.MaxConnectionAge.Duration(),
+				MaxConnectionAgeGrace: k.MaxConnectionAgeGrace.Duration(),
+				Time:                  k.Time.Duration(),
+				Timeout:               k.Timeout.Duration(),
+			}),
+			grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             k.MinTime.Duration(),
+				PermitWithoutStream: k.PermitWithoutStream,
+			}),
+		)
+	}
+	return opts
+}
+
+// reflectionEnabled reports whether the reflection service is registered, it is disabled in production mode
+// or when the mode is not configured, unless the config enables it.
+func reflectionEnabled(c *gconfig.ServerGRPCConfig) bool {
+	if c.Reflection != nil {
+		return *c.Reflection
+	}
+	prod, err := gconfig.IsProductionMode()
+	return err == nil && !prod
+}
@@ -1,34 +1,156 @@
 package status
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/samber/lo"
 	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/env"
 	"github.com/yearm/kratos-pkg/utils/debug"
+	"github.com/yearm/kratos-pkg/xgrpc/status/statuspb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// defaultLocale locale of the google.rpc.LocalizedMessage detail, the built-in messages are Simplified Chinese.
+const defaultLocale = "zh-CN"
+
 // ErrorDetail error detail structure.
 type ErrorDetail struct {
 	Code    ecodes.Code `json:"code"`
 	Message string      `json:"message"`
 	Level   log.Level   `json:"level"`
-	Callers string      `json:"callers"`
+	Callers [][]string  `json:"callers"`
+	// Args named arguments used to render the message template.
+	Args map[string]string `json:"args,omitempty"`
+	// Fields whitelisted error fields carried across services.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Violations field-level violations of the request.
+	Violations []*Violation `json:"violations,omitempty"`
+	// Hops services the error passed through, from the origin to the latest one.
+	Hops []*Hop `json:"hops,omitempty"`
+	// TruncatedHops number of hops dropped by the hop limits.
+	TruncatedHops int `json:"truncatedHops,omitempty"`
+}
+
+// Violation field-level violation of the request, e.g. converted from the validator errors.
+type Violation struct {
+	Field       string `json:"field"`
+	Rule        string `json:"rule"`
+	Param       string `json:"param,omitempty"`
+	Description string `json:"description"`
+}
+
+// ToProto convert ErrorDetail to the statuspb.ErrorDetail.
+func (e *ErrorDetail) ToProto() *statuspb.ErrorDetail {
+	return &statuspb.ErrorDetail{
+		Code:    uint32(e.Code),
+		Message: e.Message,
+		Level:   strings.ToLower(e.Level.String()),
+		Callers: lo.Map(e.Callers, func(branch []string, _ int) *statuspb.Callers {
+			return &statuspb.Callers{Callers: branch}
+		}),
+		Args:   e.Args,
+		Fields: e.Fields,
+		Violations: lo.Map(e.Violations, func(v *Violation, _ int) *statuspb.Violation {
+			return &statuspb.Violation{Field: v.Field, Rule: v.Rule, Param: v.Param, Description: v.Description}
+		}),
+		Hops: lo.Map(e.Hops, func(h *Hop, _ int) *statuspb.Hop {
+			return &statuspb.Hop{Service: h.Service, Instance: h.Instance, Operation: h.Operation, Callers: h.Callers}
+		}),
+		TruncatedHops: uint32(e.TruncatedHops),
+	}
+}
+
+// FromProto convert statuspb.ErrorDetail to the ErrorDetail.
+func FromProto(pb *statuspb.ErrorDetail) *ErrorDetail {
+	return &ErrorDetail{
+		Code:    ecodes.Code(pb.GetCode()),
+		Message: pb.GetMessage(),
+		Level:   log.ParseLevel(pb.GetLevel()),
+		Callers: lo.Map(pb.GetCallers(), func(branch *statuspb.Callers, _ int) []string {
+			return branch.GetCallers()
+		}),
+		Args:   pb.GetArgs(),
+		Fields: pb.GetFields(),
+		Violations: lo.Map(pb.GetViolations(), func(v *statuspb.Violation, _ int) *Violation {
+			return &Violation{Field: v.GetField(), Rule: v.GetRule(), Param: v.GetParam(), Description: v.GetDescription()}
+		}),
+		Hops: lo.Map(pb.GetHops(), func(h *statuspb.Hop, _ int) *Hop {
+			return &Hop{Service: h.GetService(), Instance: h.GetInstance(), Operation: h.GetOperation(), Callers: h.GetCallers()}
+		}),
+		TruncatedHops: int(pb.GetTruncatedHops()),
+	}
+}
+
+// Details returns the gRPC status details of the ErrorDetail: the typed statuspb.ErrorDetail, its legacy
+// structpb.Struct form if EnableLegacyCode is on, plus google.rpc.ErrorInfo, google.rpc.LocalizedMessage and
+// google.rpc.BadRequest (if violated) for clients that do not know kratos-pkg.
+func (e *ErrorDetail) Details() []protoadapt.MessageV1 {
+	metadata := make(map[string]string, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		metadata[k] = v
+	}
+	metadata[codeMetadataKey] = strconv.FormatUint(uint64(e.Code), 10)
+	details := []protoadapt.MessageV1{e.ToProto()}
+	if legacyCodeEnabled.Load() {
+		// the legacy form is kept for the services decoding only structpb.Struct during the migration.
+		details = append(details, e.ToStructPB())
+	}
+	details = append(details,
+		&errdetails.ErrorInfo{
+			Reason:   e.Code.Reason(),
+			Domain:   env.GetServiceName(),
+			Metadata: metadata,
+		},
+		&errdetails.LocalizedMessage{
+			Locale:  defaultLocale,
+			Message: e.Message,
+		},
+	)
+	if len(e.Violations) > 0 {
+		details = append(details, &errdetails.BadRequest{
+			FieldViolations: lo.Map(e.Violations, func(v *Violation, _ int) *errdetails.BadRequest_FieldViolation {
+				return &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: v.Description}
+			}),
+		})
+	}
+	return details
 }
 
-// ToMap convert ErrorDetail to the map[string]any
+// newStatus creates a gRPC status carrying the error details.
+func (e *ErrorDetail) newStatus(code codes.Code, message string) *status.Status {
+	st := status.New(code, message)
+	if withDetails, err := st.WithDetails(e.Details()...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// ToMap convert ErrorDetail to the map[string]any of the legacy structpb form.
 func (e *ErrorDetail) ToMap() map[string]any {
+	callers := lo.Map(e.Callers, func(branch []string, _ int) any {
+		return lo.Map(branch, func(caller string, _ int) any { return caller })
+	})
 	return map[string]any{
 		"code":    uint32(e.Code),
 		"message": e.Message,
 		"level":   strings.ToLower(e.Level.String()),
-		"callers": e.Callers,
+		"callers": callers,
+		"args":    lo.MapValues(e.Args, func(v string, _ string) any { return v }),
+		"fields":  lo.MapValues(e.Fields, func(v string, _ string) any { return v }),
 	}
 }
 
-// ToStructPB convert ErrorDetail to the structpb.Struct.
+// ToStructPB convert ErrorDetail to the legacy structpb.Struct form, the statuses carry it beside
+// statuspb.ErrorDetail for the services that have not migrated if EnableLegacyCode is on.
 func (e *ErrorDetail) ToStructPB() *structpb.Struct {
 	st, _ := structpb.NewStruct(e.ToMap())
 	return st
@@ -40,25 +162,64 @@ func (e *ErrorDetail) WrapCallers(depth ...int) *ErrorDetail {
 	if len(depth) > 0 {
 		d = depth[0]
 	}
-	if e.Callers == "[]" {
-		e.Callers = strings.Replace(e.Callers, "[", fmt.Sprintf(`["%s"`, debug.Caller(d)), 1)
-	} else {
-		e.Callers = strings.Replace(e.Callers, "[", fmt.Sprintf(`["%s", `, debug.Caller(d)), 1)
-	}
+	e.Callers = PrependCaller(e.Callers, debug.Caller(d))
 	return e
 }
 
-// ToErrorDetail convert structpb.Struct to the ErrorDetail.
+// ToErrorDetail convert the legacy structpb.Struct form to the ErrorDetail.
 func ToErrorDetail(st *structpb.Struct) *ErrorDetail {
 	m := st.AsMap()
 	code, _ := m["code"].(float64)
 	message, _ := m["message"].(string)
 	level, _ := m["level"].(string)
-	callers, _ := m["callers"].(string)
+	args, _ := m["args"].(map[string]any)
+	fields, _ := m["fields"].(map[string]any)
 	return &ErrorDetail{
 		Code:    ecodes.Code(code),
 		Message: message,
 		Level:   log.ParseLevel(level),
-		Callers: callers,
+		Callers: toCallers(m["callers"]),
+		Args:    formatArgs(args),
+		Fields:  formatArgs(fields),
+	}
+}
+
+// formatArgs stringifies the named arguments or fields so that they can be carried in the ErrorDetail.
+func formatArgs(args map[string]any) map[string]string {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(args))
+	for k, v := range args {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
+}
+
+// PrependCaller prepends the caller to every branch of the callers, a new branch is created if there is none.
+func PrependCaller(callers [][]string, caller string) [][]string {
+	if len(callers) == 0 {
+		return [][]string{{caller}}
+	}
+	return lo.Map(callers, func(branch []string, _ int) []string {
+		return append([]string{caller}, branch...)
+	})
+}
+
+// toCallers decodes the callers of the structpb form, the legacy form is a JSON array string of a single branch.
+func toCallers(v any) [][]string {
+	switch x := v.(type) {
+	case []any:
+		return lo.Map(x, func(branch any, _ int) []string {
+			callers, _ := branch.([]any)
+			return lo.Map(callers, func(caller any, _ int) string { return fmt.Sprint(caller) })
+		})
+	case string:
+		var branch []string
+		if err := json.Unmarshal([]byte(x), &branch); err != nil || len(branch) == 0 {
+			return [][]string{}
+		}
+		return [][]string{branch}
 	}
+	return [][]string{}
 }
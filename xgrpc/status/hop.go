@@ -0,0 +1,126 @@
+package status
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/yearm/kratos-pkg/env"
+)
+
+const (
+	// defaultHopMaxDepth default maximum number of hops carried in the ErrorDetail.
+	defaultHopMaxDepth = 16
+	// defaultHopMaxBytes default maximum size in bytes of the hops carried in the ErrorDetail.
+	defaultHopMaxBytes = 4 << 10
+	// truncatedCallersMarker marker of the callers trimmed by the byte limit.
+	truncatedCallersMarker = "...(%d more)"
+)
+
+var (
+	hopMaxDepth   = defaultHopMaxDepth
+	hopMaxBytes   = defaultHopMaxBytes
+	hopLimitsOnce sync.Once
+)
+
+// SetHopLimits sets the maximum number of hops and the maximum size in bytes of the hops carried in the ErrorDetail,
+// non-positive values keep the defaults. Only the first call takes effect.
+func SetHopLimits(maxDepth, maxBytes int) {
+	hopLimitsOnce.Do(func() {
+		if maxDepth > 0 {
+			hopMaxDepth = maxDepth
+		}
+		if maxBytes > 0 {
+			hopMaxBytes = maxBytes
+		}
+	})
+}
+
+// Hop a service the error passed through.
+type Hop struct {
+	Service   string   `json:"service"`
+	Instance  string   `json:"instance,omitempty"`
+	Operation string   `json:"operation,omitempty"`
+	Callers   []string `json:"callers,omitempty"`
+}
+
+// newHop creates the hop of the current service, the operation is taken from the server transport of ctx.
+func newHop(ctx context.Context, callers ...string) *Hop {
+	hop := &Hop{
+		Service:  env.GetServiceName(),
+		Instance: env.GetServiceID(),
+		Callers:  callers,
+	}
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		hop.Operation = tr.Operation()
+	}
+	return hop
+}
+
+// same reports whether both hops are recorded by the same operation of the same service instance.
+func (h *Hop) same(o *Hop) bool {
+	return h.Service == o.Service && h.Instance == o.Instance && h.Operation == o.Operation
+}
+
+// size returns the approximate size in bytes of the hop.
+func (h *Hop) size() int {
+	n := len(h.Service) + len(h.Instance) + len(h.Operation)
+	for _, caller := range h.Callers {
+		n += len(caller)
+	}
+	return n
+}
+
+// AddHop records that the error passed through the current service, the caller is merged into the latest hop
+// if it was recorded by the same operation. The hops are truncated by the hop limits, see SetHopLimits.
+func (e *ErrorDetail) AddHop(ctx context.Context, caller string) *ErrorDetail {
+	hop := newHop(ctx, caller)
+	if n := len(e.Hops); n > 0 && e.Hops[n-1].same(hop) {
+		e.Hops[n-1].Callers = append([]string{caller}, e.Hops[n-1].Callers...)
+	} else {
+		e.Hops = append(e.Hops, hop)
+	}
+	e.truncateHops()
+	return e
+}
+
+// truncateHops drops the oldest hops except the origin until the hop limits are satisfied,
+// the callers of the remaining hops are trimmed if they still exceed the byte limit.
+func (e *ErrorDetail) truncateHops() {
+	for len(e.Hops) > 2 && (len(e.Hops) > hopMaxDepth || hopsSize(e.Hops) > hopMaxBytes) {
+		e.Hops = slices.Delete(e.Hops, 1, 2)
+		e.TruncatedHops++
+	}
+	for _, hop := range e.Hops {
+		if hopsSize(e.Hops) <= hopMaxBytes {
+			return
+		}
+		if n := len(hop.Callers); n > 1 {
+			hop.Callers = []string{hop.Callers[0], fmt.Sprintf(truncatedCallersMarker, n-1)}
+		}
+	}
+}
+
+// hopsSize returns the approximate size in bytes of the hops.
+func hopsSize(hops []*Hop) int {
+	n := 0
+	for _, hop := range hops {
+		n += hop.size()
+	}
+	return n
+}
+
+// OriginService returns the service that originated the error, it is empty if the detail records no hop.
+func (e *ErrorDetail) OriginService() string {
+	if len(e.Hops) == 0 {
+		return ""
+	}
+	return e.Hops[0].Service
+}
+
+// HopCount returns the number of services the error passed through, including the truncated hops.
+func (e *ErrorDetail) HopCount() int {
+	return len(e.Hops) + e.TruncatedHops
+}
@@ -0,0 +1,84 @@
+package status
+
+import (
+	"strconv"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	httpstatus "github.com/go-kratos/kratos/v2/transport/http/status"
+	"github.com/yearm/kratos-pkg/ecodes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// codeMetadataKey metadata key of the business code in the kratos error and google.rpc.ErrorInfo.
+const codeMetadataKey = "code"
+
+// ToKratosError converts the ErrorDetail into a kratos *errors.Error. The HTTP code is derived from the business code,
+// the reason is the reason of the business code and the metadata carries the fields along with the business code.
+func (e *ErrorDetail) ToKratosError() *kerrors.Error {
+	metadata := make(map[string]string, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		metadata[k] = v
+	}
+	metadata[codeMetadataKey] = strconv.FormatUint(uint64(e.Code), 10)
+	return kerrors.New(httpstatus.FromGRPCCode(e.Code.GRPCCode()), e.Code.Reason(), e.Message).WithMetadata(metadata)
+}
+
+// FromKratosError converts a kratos *errors.Error into the ErrorDetail. The business code is taken from the metadata,
+// then from the reason, and falls back to the code derived from the HTTP code; the other metadata become the fields.
+func FromKratosError(ke *kerrors.Error) *ErrorDetail {
+	if ke == nil {
+		return nil
+	}
+	code := kratosCode(ke)
+	var fields map[string]string
+	for k, v := range ke.Metadata {
+		if k == codeMetadataKey {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]string, len(ke.Metadata))
+		}
+		fields[k] = v
+	}
+	return &ErrorDetail{
+		Code:    code,
+		Message: ke.Message,
+		Level:   code.Level(),
+		Callers: [][]string{},
+		Fields:  fields,
+	}
+}
+
+// ToKratos converts err into a kratos *errors.Error, status errors carrying an ErrorDetail keep the business code.
+func ToKratos(err error) *kerrors.Error {
+	if err == nil {
+		return nil
+	}
+	if _, detail, ok := ParseError(err); ok && detail != nil {
+		return detail.ToKratosError().WithCause(err)
+	}
+	return kerrors.FromError(err)
+}
+
+// kratosCode resolves the business code of a kratos error.
+func kratosCode(ke *kerrors.Error) ecodes.Code {
+	if v, ok := ke.Metadata[codeMetadataKey]; ok {
+		if code, err := strconv.ParseUint(v, 10, 32); err == nil {
+			return ecodes.Code(code)
+		}
+	}
+	if code, ok := ecodes.FromReason(ke.Reason); ok {
+		return code
+	}
+	return ecodes.FromGRPCCode(httpstatus.ToGRPCCode(int(ke.Code)))
+}
+
+// fromErrorInfo builds the ErrorDetail from the google.rpc.ErrorInfo detail, e.g. sent by plain kratos services.
+// The domain of the ErrorInfo is the name of the origin service.
+func fromErrorInfo(code int, message string, info *errdetails.ErrorInfo) *ErrorDetail {
+	detail := FromKratosError(kerrors.New(code, info.GetReason(), message).WithMetadata(info.GetMetadata()))
+	if info.GetDomain() != "" {
+		detail.Hops = []*Hop{{Service: info.GetDomain()}}
+	}
+	return detail
+}
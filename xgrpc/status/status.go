@@ -3,20 +3,105 @@ package status
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/go-kratos/kratos/v2/log"
+	httpstatus "github.com/go-kratos/kratos/v2/transport/http/status"
 	"github.com/yearm/kratos-pkg/ecodes"
 	"github.com/yearm/kratos-pkg/env"
 	"github.com/yearm/kratos-pkg/errors"
+	"github.com/yearm/kratos-pkg/utils/debug"
+	"github.com/yearm/kratos-pkg/xgrpc/status/statuspb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// LegacyCode the fixed gRPC status code used by status errors before the codes were derived from the business codes.
+const LegacyCode codes.Code = 101
+
+// legacyCodeEnabled controls whether status errors use LegacyCode instead of the derived gRPC status code.
+var legacyCodeEnabled atomic.Bool
+
+// EnableLegacyCode switches the status errors back to the fixed LegacyCode and the legacy structpb.Struct form
+// of the error detail for consumers that rely on them. By default the gRPC status code is derived from the business
+// code, which is still carried in the ErrorDetail.
+func EnableLegacyCode(enable bool) {
+	legacyCodeEnabled.Store(enable)
+}
+
+// grpcCode returns the gRPC status code of the business code, codes.OK is never used for an error.
+func grpcCode(code ecodes.Code) codes.Code {
+	if legacyCodeEnabled.Load() {
+		return LegacyCode
+	}
+	if c := code.GRPCCode(); c != codes.OK {
+		return c
+	}
+	return codes.Unknown
+}
+
+var (
+	// detailFieldKeys whitelist of the error field keys carried in the ErrorDetail.
+	detailFieldKeys     map[string]struct{}
+	detailFieldKeysOnce sync.Once
+)
+
+// SetDetailFieldKeys sets the whitelist of error field keys (see errors.WithFields) carried in the ErrorDetail,
+// so that they survive service hops. No field is carried by default, only the first call takes effect.
+func SetDetailFieldKeys(keys ...string) {
+	detailFieldKeysOnce.Do(func() {
+		detailFieldKeys = make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			detailFieldKeys[key] = struct{}{}
+		}
+	})
+}
+
+// detailFields picks the whitelisted fields of the error chain.
+func detailFields(err error) map[string]any {
+	if len(detailFieldKeys) == 0 {
+		return nil
+	}
+	fields := errors.Fields(err)
+	for key := range fields {
+		if _, ok := detailFieldKeys[key]; !ok {
+			delete(fields, key)
+		}
+	}
+	return fields
+}
+
+// statusError is a gRPC status error that keeps the local cause, e.g. for logging the stack trace.
+// Only the status is transmitted to the peers.
+type statusError struct {
+	st    *status.Status
+	cause error
+}
+
+// Error implements error interface, returns the same message as the gRPC status error.
+func (e *statusError) Error() string {
+	return e.st.Err().Error()
+}
+
+// GRPCStatus returns the gRPC status, it is used by status.FromError.
+func (e *statusError) GRPCStatus() *status.Status {
+	return e.st
+}
+
+// Unwrap returns the local cause of the status error.
+func (e *statusError) Unwrap() error {
+	return e.cause
+}
+
 type Option func(*options)
 type options struct {
-	message string
-	level   log.Level
+	message    string
+	level      log.Level
+	args       map[string]any
+	violations []*Violation
 }
 
 // WithMessage used to set the error message.
@@ -26,6 +111,20 @@ func WithMessage(message string) Option {
 	}
 }
 
+// WithArgs used to set the named arguments of the message template, e.g. {"orderId": 1} for "order {orderId} not found".
+func WithArgs(args map[string]any) Option {
+	return func(o *options) {
+		o.args = args
+	}
+}
+
+// WithViolations used to set the field-level violations of the request.
+func WithViolations(violations ...*Violation) Option {
+	return func(o *options) {
+		o.violations = violations
+	}
+}
+
 // WithLevel used to set the error log level.
 func WithLevel(level log.Level) Option {
 	return func(o *options) {
@@ -33,48 +132,111 @@ func WithLevel(level log.Level) Option {
 	}
 }
 
-// Error create a gRPC status error carrying the error details.
+// Error create a gRPC status error carrying the error details, the log level defaults to the level of the code.
 func Error(ctx context.Context, code ecodes.Code, err error, opts ...Option) error {
+	return newError(ctx, code, err, 4, opts...)
+}
+
+// newError create a gRPC status error, depth: call stack depth of the recorded caller.
+// UnknownError is refined by the registered error translators when they match the error.
+func newError(ctx context.Context, code ecodes.Code, err error, depth int, opts ...Option) error {
+	if code == ecodes.UnknownError {
+		if info, ok := errors.Translate(err); ok {
+			code = info.Code
+			opts = append(codeOptions(info), opts...)
+		}
+	}
 	opt := options{
 		message: code.Message(ctx),
-		level:   log.LevelError,
+		level:   code.Level(),
 	}
 	for _, o := range opts {
 		o(&opt)
 	}
 
-	err = errors.WrapDepth(err, 3)
-	detail := (&ErrorDetail{
-		Code:    code,
-		Message: opt.message,
-		Level:   opt.level,
-		Callers: errors.Callers(err),
-	}).ToStructPB()
-	st, _ := status.New(codes.Code(101), fmt.Sprintf("[%s] %v", env.GetServiceName(), err)).WithDetails(detail)
-	return st.Err()
+	err = errors.WrapDepth(err, depth)
+	detail := &ErrorDetail{
+		Code:       code,
+		Message:    ecodes.FormatMessage(opt.message, opt.args),
+		Level:      opt.level,
+		Callers:    errors.Callers(err),
+		Args:       formatArgs(opt.args),
+		Fields:     formatArgs(detailFields(err)),
+		Violations: opt.violations,
+	}
+	// the hops and message of a downstream status error are kept, so that the origin service is still known
+	// and the message does not grow at every hop. The service prefix is added only where the error starts.
+	message := fmt.Sprintf("[%s] %v", env.GetServiceName(), err)
+	if _, prev, ok := ParseError(err); ok {
+		if prev != nil {
+			detail.Hops, detail.TruncatedHops = prev.Hops, prev.TruncatedHops
+		}
+		message = statusMessage(err)
+	}
+	detail.AddHop(ctx, debug.Caller(depth-1))
+	st := detail.newStatus(grpcCode(code), message)
+	return &statusError{st: st, cause: err}
+}
+
+// Convert converts err into a gRPC status error. gRPC status errors are returned as is unless a code is bound
+// outside them by errors.WithCode, errors bound with a code or matched by the error translators use that code,
+// others are reported as UnknownError.
+func Convert(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if info, ok := errors.OuterCodeOf(err); ok {
+		return newError(ctx, info.Code, err, 4, codeOptions(info)...)
+	}
+	if _, _, ok := ParseError(err); ok {
+		return err
+	}
+
+	if info, ok := errors.CodeOf(err); ok {
+		return newError(ctx, info.Code, err, 4, codeOptions(info)...)
+	}
+	return newError(ctx, ecodes.UnknownError, err, 4)
+}
+
+// codeOptions converts the code information bound to an error into options.
+func codeOptions(info *errors.CodeInfo) []Option {
+	return []Option{WithCodeInfo(info)}
+}
+
+// WithCodeInfo used to set the level and message of the code information bound to an error, see errors.WithCode.
+func WithCodeInfo(info *errors.CodeInfo) Option {
+	return func(o *options) {
+		if info.Level != nil {
+			o.level = *info.Level
+		}
+		if info.Message != "" {
+			o.message = info.Message
+		}
+	}
 }
 
-// WrapError wrap the existing errors and append the new call location information.
+// WrapError wrap the existing errors and record the new call location in the hop of the current service.
 func WrapError(ctx context.Context, err error, msg ...string) error {
 	if err == nil {
 		return nil
 	}
-	st, detail, ok := FromError(err)
+	st, detail, ok := ParseError(err)
 	if !ok || detail == nil {
 		return Error(ctx, ecodes.UnknownError, err)
 	}
 
-	errorDetail := ToErrorDetail(detail).WrapCallers(3)
+	detail.AddHop(ctx, debug.Caller(2))
 	message := st.Message()
 	if len(msg) > 0 && msg[0] != "" {
 		message = fmt.Sprintf("%s: %s", msg[0], st.Message())
 	}
-	afterSt, _ := status.New(st.Code(), message).WithDetails(errorDetail.ToStructPB())
-	return afterSt.Err()
+	return &statusError{st: detail.newStatus(st.Code(), message), cause: err}
 }
 
-// FromError extract gRPC status and error detail from error.
-func FromError(err error) (*status.Status, *structpb.Struct, bool) {
+// ParseError extract gRPC status and error detail from error, the detail is nil if the status does not carry one.
+// Both the typed statuspb.ErrorDetail and the legacy structpb.Struct form are decoded, statuses of plain kratos errors
+// are decoded from their google.rpc.ErrorInfo.
+func ParseError(err error) (*status.Status, *ErrorDetail, bool) {
 	if err == nil {
 		return nil, nil, false
 	}
@@ -82,28 +244,113 @@ func FromError(err error) (*status.Status, *structpb.Struct, bool) {
 	if !ok || st == nil {
 		return nil, nil, false
 	}
+	var (
+		legacy *structpb.Struct
+		info   *errdetails.ErrorInfo
+	)
 	for _, detail := range st.Details() {
-		if v, ok := detail.(*structpb.Struct); ok {
-			return st, v, true
+		switch v := detail.(type) {
+		case *statuspb.ErrorDetail:
+			return st, FromProto(v), true
+		case *structpb.Struct:
+			legacy = v
+		case *errdetails.ErrorInfo:
+			info = v
 		}
 	}
+	if legacy != nil {
+		return st, ToErrorDetail(legacy), true
+	}
+	if info != nil {
+		return st, fromErrorInfo(httpstatus.FromGRPCCode(st.Code()), statusMessage(err), info), true
+	}
 	return st, nil, true
 }
 
+// statusMessage returns the message of the status of err. status.FromError replaces the message of wrapped errors
+// with the whole error string, so the message is taken from the wrapped status error itself.
+func statusMessage(err error) string {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) && se.GRPCStatus() != nil {
+		return se.GRPCStatus().Message()
+	}
+	st, _ := status.FromError(err)
+	return st.Message()
+}
+
+// FromError extract gRPC status and the legacy structpb.Struct form of the error detail from error.
+//
+// Deprecated: the error detail is carried as statuspb.ErrorDetail, use ParseError instead.
+func FromError(err error) (*status.Status, *structpb.Struct, bool) {
+	st, detail, ok := ParseError(err)
+	if !ok || detail == nil {
+		return st, nil, ok
+	}
+	return st, detail.ToStructPB(), true
+}
+
 // FromErrorDetail parse the ErrorDetail structure from the error.
 func FromErrorDetail(ctx context.Context, err error) *ErrorDetail {
 	if err == nil {
 		return nil
 	}
-	_, detail, ok := FromError(err)
+	_, detail, ok := ParseError(err)
 	if !ok || detail == nil {
 		err = errors.WrapDepth(err, 3)
 		return &ErrorDetail{
 			Code:    ecodes.UnknownError,
 			Message: ecodes.UnknownError.Message(ctx),
-			Level:   log.LevelError,
+			Level:   ecodes.UnknownError.Level(),
 			Callers: errors.Callers(err),
 		}
 	}
-	return ToErrorDetail(detail)
+	return detail
+}
+
+// Code returns the business code of err: OK for nil, the code bound outside the status by errors.WithCode,
+// the code of the ErrorDetail or derived from the gRPC status code, the code bound by errors.WithCode,
+// otherwise UnknownError.
+func Code(err error) ecodes.Code {
+	if err == nil {
+		return ecodes.OK
+	}
+	if info, ok := errors.OuterCodeOf(err); ok {
+		return info.Code
+	}
+	if st, detail, ok := ParseError(err); ok {
+		if detail != nil {
+			return detail.Code
+		}
+		return ecodes.FromGRPCCode(st.Code())
+	}
+	if info, ok := errors.CodeOf(err); ok {
+		return info.Code
+	}
+	return ecodes.UnknownError
+}
+
+// IsRetryable reports whether the request that failed with err is safe to retry according to its error code.
+func IsRetryable(err error) bool {
+	st, detail, ok := ParseError(err)
+	if !ok {
+		return false
+	}
+	if detail == nil {
+		return ecodes.FromGRPCCode(st.Code()).Retryable()
+	}
+	return detail.Code.Retryable()
+}
+
+// Fields collects the error fields of err, including the fields carried in the ErrorDetail by upstream services.
+// The local fields take precedence over the carried ones.
+func Fields(err error) map[string]any {
+	fields := errors.Fields(err)
+	if _, detail, ok := ParseError(err); ok && detail != nil {
+		for key, value := range detail.Fields {
+			if _, ok := fields[key]; !ok {
+				fields[key] = value
+			}
+		}
+	}
+	return fields
 }
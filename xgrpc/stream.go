@@ -0,0 +1,136 @@
+package xgrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/yearm/kratos-pkg/logger"
+	"github.com/yearm/kratos-pkg/utils/gjson"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// StreamRecovery is a stream server interceptor that recovers the panics of the handlers into status errors.
+func StreamRecovery() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if e := recover(); e != nil {
+				err = recoveredError(ss.Context(), e, info.FullMethod)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// StreamValidator is a stream server interceptor that validates every received message like Validator,
+// the receiving fails with the InvalidArgument status error if a message is invalid.
+func StreamValidator() grpc.StreamServerInterceptor {
+	validate := newValidateFunc()
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatedStream{ServerStream: ss, validate: validate})
+	}
+}
+
+// validatedStream validates the received messages.
+type validatedStream struct {
+	grpc.ServerStream
+	validate func(ctx context.Context, req any) error
+}
+
+// RecvMsg receives the message and validates it.
+func (s *validatedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.validate(s.Context(), m)
+}
+
+// StreamLog is a stream server logging interceptor, it logs the opening of the streams, and their closing with
+// the message counts, bytes, duration and final status. The messages are logged at debug level if messageLog is true.
+func StreamLog(messageLog bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		startTime := time.Now()
+
+		requestLog := logger.RequestLog{Method: info.FullMethod}
+		if tr, ok := transport.FromServerContext(ctx); ok {
+			requestLog.Kind = tr.Kind().String()
+			requestLog.Endpoint = tr.Endpoint()
+			requestLog.Header = gjson.MustMarshalToString(tr.RequestHeader())
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			requestLog.ClientIP = p.Addr.String()
+		}
+		log.Context(ctx).Log(log.LevelInfo, log.DefaultMessageKey, "grpc stream opened", logger.RequestKey, requestLog)
+
+		ls := &loggedStream{ServerStream: ss, messageLog: messageLog}
+		err := handler(srv, ls)
+
+		level, responseLog := newResponseLog(nil, err, time.Since(startTime))
+		keyvals := []any{
+			log.DefaultMessageKey, "grpc stream closed",
+			logger.RequestKey, requestLog,
+			logger.ResponseKey, responseLog,
+			logger.StreamKey, ls.streamLog(),
+		}
+		log.Context(ctx).Log(level, append(keyvals, logger.FieldKeyvals(status.Fields(err))...)...)
+		return err
+	}
+}
+
+// loggedStream counts the messages and bytes of the stream, and logs the messages if messageLog is true.
+type loggedStream struct {
+	grpc.ServerStream
+	messageLog bool
+
+	recvMsgs, sentMsgs, recvBytes, sentBytes atomic.Int64
+}
+
+// RecvMsg receives the message and counts it.
+func (s *loggedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.recvMsgs.Add(1)
+	s.recvBytes.Add(messageSize(m))
+	if s.messageLog {
+		log.Context(s.Context()).Log(log.LevelDebug, log.DefaultMessageKey, "grpc stream message received", "message", protoToString(m))
+	}
+	return nil
+}
+
+// SendMsg sends the message and counts it.
+func (s *loggedStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.sentMsgs.Add(1)
+	s.sentBytes.Add(messageSize(m))
+	if s.messageLog {
+		log.Context(s.Context()).Log(log.LevelDebug, log.DefaultMessageKey, "grpc stream message sent", "message", protoToString(m))
+	}
+	return nil
+}
+
+// streamLog returns the stream log of the counts.
+func (s *loggedStream) streamLog() logger.StreamLog {
+	return logger.StreamLog{
+		RecvMsgs:  s.recvMsgs.Load(),
+		SentMsgs:  s.sentMsgs.Load(),
+		RecvBytes: s.recvBytes.Load(),
+		SentBytes: s.sentBytes.Load(),
+	}
+}
+
+// messageSize returns the encoded size of the proto message, it is 0 for other messages.
+func messageSize(m any) int64 {
+	if v, ok := m.(proto.Message); ok {
+		return int64(proto.Size(v))
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package xgrpc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+)
+
+// ClientTimeout is a client middleware that applies the timeout of the operation from the client config,
+// falling back to the timeout of the client. The shorter of it and the deadline of the caller wins.
+// The timeouts of configs loaded by gconfig.GetClientGRPCConfig are updated when the config changes.
+// The connections created by this package apply it to every attempt, including the retries and the hedged attempts,
+// see attemptMiddlewares.
+func ClientTimeout(c *gconfig.ClientGRPCConfig) middleware.Middleware {
+	var timeouts atomic.Pointer[clientTimeouts]
+	timeouts.Store(newClientTimeouts(c))
+	if c.Name() != "" {
+		err := gconfig.WatchClientGRPCConfig(c.Name(), func(c *gconfig.ClientGRPCConfig) {
+			timeouts.Store(newClientTimeouts(c))
+			log.Infow(log.DefaultMessageKey, "grpc client timeouts updated", "client", c.Name())
+		})
+		if err != nil {
+			log.Warnw(log.DefaultMessageKey, "watch grpc client timeouts failed", "client", c.Name(), "error", err.Error())
+		}
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var operation string
+			if info, ok := transport.FromClientContext(ctx); ok {
+				operation = info.Operation()
+			}
+			if timeout := timeouts.Load().get(operation); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// clientTimeouts timeouts of the client and its operations.
+type clientTimeouts struct {
+	timeout time.Duration
+	methods map[string]time.Duration
+}
+
+// newClientTimeouts creates the timeouts from the client config.
+func newClientTimeouts(c *gconfig.ClientGRPCConfig) *clientTimeouts {
+	t := &clientTimeouts{
+		timeout: time.Duration(c.Timeout) * time.Second,
+		methods: make(map[string]time.Duration, len(c.Methods)),
+	}
+	for operation, m := range c.Methods {
+		if m != nil && m.Timeout > 0 {
+			t.methods[operation] = m.Timeout.Duration()
+		}
+	}
+	return t
+}
+
+// get returns the timeout of the operation, 0 means no timeout.
+func (t *clientTimeouts) get(operation string) time.Duration {
+	if timeout, ok := t.methods[operation]; ok {
+		return timeout
+	}
+	return t.timeout
+}
@@ -0,0 +1,236 @@
+package xgrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/yearm/kratos-pkg/config/gconfig"
+	"github.com/yearm/kratos-pkg/errors"
+)
+
+// NewClientTLSConfig creates the client TLS config. The certificate and key are presented for mTLS,
+// the CA bundle verifies the server instead of the system roots, and the files are reloaded on change
+// if the reload interval is set.
+func NewClientTLSConfig(c *gconfig.TLSConfig) (*tls.Config, error) {
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "newCertReloader failed")
+	}
+	config := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tlsVersion(c.MinVersion),
+	}
+	if c.CertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		}
+	}
+	if c.CAFile == "" {
+		return config, nil
+	}
+	if c.ReloadInterval == 0 {
+		config.RootCAs = r.caPool()
+		return config, nil
+	}
+	// the server is verified by the reloaded CA bundle in VerifyConnection instead of the static RootCAs.
+	config.InsecureSkipVerify = true
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPeer(cs, x509.VerifyOptions{
+			DNSName: cs.ServerName,
+			Roots:   r.caPool(),
+		})
+	}
+	return config, nil
+}
+
+// NewServerTLSConfig creates the server TLS config. The CA bundle requires and verifies the client
+// certificates (mTLS), and the files are reloaded on change if the reload interval is set.
+func NewServerTLSConfig(c *gconfig.TLSConfig) (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("certFile and keyFile are required")
+	}
+	r, err := newCertReloader(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "newCertReloader failed")
+	}
+	config := &tls.Config{
+		MinVersion: tlsVersion(c.MinVersion),
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		},
+	}
+	if c.CAFile == "" {
+		return config, nil
+	}
+	if c.ReloadInterval == 0 {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = r.caPool()
+		return config, nil
+	}
+	// the client certificates are verified by the reloaded CA bundle in VerifyConnection instead of the static ClientCAs.
+	config.ClientAuth = tls.RequireAnyClientCert
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		return verifyPeer(cs, x509.VerifyOptions{
+			Roots:     r.caPool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+	}
+	return config, nil
+}
+
+// verifyPeer verifies the peer certificate chain of the connection.
+func verifyPeer(cs tls.ConnectionState, opts x509.VerifyOptions) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificate")
+	}
+	opts.Intermediates = x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// tlsVersion parses the TLS version, TLS 1.2 is used by default.
+func tlsVersion(version string) uint16 {
+	switch version {
+	case "1.0":
+		return tls.VersionTLS10
+	case "1.1":
+		return tls.VersionTLS11
+	case "1.3":
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// certReloader loads the certificate and CA bundle files, and reloads them when their modification time changes.
+// The files are checked at most once per interval, the loaded ones are kept if reloading fails.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// newCertReloader creates a certReloader and loads the files.
+func newCertReloader(c *gconfig.TLSConfig) (*certReloader, error) {
+	r := &certReloader{
+		certFile: c.CertFile,
+		keyFile:  c.KeyFile,
+		caFile:   c.CAFile,
+		interval: time.Duration(c.ReloadInterval) * time.Second,
+	}
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// certificate returns the current certificate.
+func (r *certReloader) certificate() *tls.Certificate {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// caPool returns the current CA pool.
+func (r *certReloader) caPool() *x509.CertPool {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// maybeReload reloads the files if the interval has elapsed since the last check and they were modified.
+func (r *certReloader) maybeReload() {
+	if r.interval <= 0 {
+		return
+	}
+	r.mu.RLock()
+	due := time.Since(r.checkedAt) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	r.mu.Lock()
+	r.checkedAt = time.Now()
+	lastModTime := r.modTime
+	r.mu.Unlock()
+	modTime, err := r.latestModTime()
+	if err == nil && modTime.Equal(lastModTime) {
+		return
+	}
+	if err == nil {
+		err = r.load(modTime)
+	}
+	if err != nil {
+		log.Errorw(log.DefaultMessageKey, "reload tls files failed", "error", err.Error())
+		return
+	}
+	log.Infow(log.DefaultMessageKey, "tls files reloaded", "certFile", r.certFile, "caFile", r.caFile)
+}
+
+// load loads the certificate and CA bundle files.
+func (r *certReloader) load(modTime time.Time) error {
+	var (
+		cert *tls.Certificate
+		pool *x509.CertPool
+	)
+	if r.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrap(err, "tls.LoadX509KeyPair failed")
+		}
+		cert = &c
+	}
+	if r.caFile != "" {
+		ca, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "os.ReadFile failed")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.Errorf("no certificate found in %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime = cert, pool, modTime
+	return nil
+}
+
+// latestModTime returns the latest modification time of the files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "os.Stat failed")
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/samber/lo"
 	"github.com/yearm/kratos-pkg/ecodes"
 	"github.com/yearm/kratos-pkg/errors"
 	"github.com/yearm/kratos-pkg/utils/debug"
@@ -33,11 +33,16 @@ type Response struct {
 	Code    ecodes.Code `json:"code"`
 	Message string      `json:"message"`
 	Data    any         `json:"data,omitempty"`
+	// Errors field-level violations of the request, e.g. for form UIs to show field-level messages.
+	Errors []*status.Violation `json:"errors,omitempty"`
 
 	ctx        context.Context
 	httpCode   int
 	err        error
-	callers    string
+	callers    [][]string
+	args       map[string]string
+	origin     string
+	hopCount   int
 	level      log.Level
 	renderType RenderType
 }
@@ -56,7 +61,8 @@ func NewSuccess(ctx context.Context, data any) *Response {
 	return r
 }
 
-// NewError creates an error API response with stack trace.
+// NewError creates an error API response with stack trace, the log level defaults to the level of the code.
+// UnknownError is refined by the registered error translators when they match the error.
 func NewError(ctx context.Context, code ecodes.Code, err error) *Response {
 	err = errors.WrapDepth(err, 3)
 	r := &Response{
@@ -66,13 +72,20 @@ func NewError(ctx context.Context, code ecodes.Code, err error) *Response {
 		httpCode:   http.StatusOK,
 		err:        err,
 		callers:    errors.Callers(err),
-		level:      log.LevelError,
+		level:      code.Level(),
 		renderType: JSON,
 	}
+	if code == ecodes.UnknownError {
+		if info, ok := errors.Translate(err); ok {
+			r.WithCodeInfo(info)
+		}
+	}
 	return r
 }
 
-// FromError constructs a structured Response from an error.
+// FromError constructs a structured Response from an error, errors bound with a code by errors.WithCode
+// or matched by the error translators are rendered with that code. A code bound outside a status error
+// takes precedence over the code of the status.
 func FromError(ctx context.Context, err error) *Response {
 	err = errors.WrapDepth(err, 3)
 	r := &Response{
@@ -83,10 +96,17 @@ func FromError(ctx context.Context, err error) *Response {
 		level:      log.LevelError,
 		renderType: JSON,
 	}
-	st, detail, ok := status.FromError(err)
+	if info, ok := errors.OuterCodeOf(err); ok {
+		return r.WithCodeInfo(info)
+	}
+	st, detail, ok := status.ParseError(err)
 	if !ok {
+		if info, ok := errors.CodeOf(err); ok {
+			return r.WithCodeInfo(info)
+		}
 		r.Code = ecodes.UnknownError
 		r.Message = ecodes.UnknownError.Message(ctx)
+		r.level = ecodes.UnknownError.Level()
 		return r
 	}
 
@@ -94,13 +114,31 @@ func FromError(ctx context.Context, err error) *Response {
 		code := ecodes.FromGRPCCode(st.Code())
 		r.Code = code
 		r.Message = code.Message(ctx)
+		r.level = code.Level()
 		return r
 	}
 
-	errorDetail := status.ToErrorDetail(detail)
-	r.Code = errorDetail.Code
-	r.Message = errorDetail.Message
-	r.level = errorDetail.Level
+	r.Code = detail.Code
+	r.Message = detail.Message
+	r.args = detail.Args
+	r.origin = detail.OriginService()
+	r.hopCount = detail.HopCount()
+	r.level = detail.Level
+	r.Errors = detail.Violations
+	return r
+}
+
+// WithCodeInfo sets the code, message and level of the response from the code information bound to an error.
+func (r *Response) WithCodeInfo(info *errors.CodeInfo) *Response {
+	r.Code = info.Code
+	r.Message = info.Code.Message(r.ctx)
+	r.level = info.Code.Level()
+	if info.Message != "" {
+		r.Message = info.Message
+	}
+	if info.Level != nil {
+		r.level = *info.Level
+	}
 	return r
 }
 
@@ -117,9 +155,16 @@ func (r *Response) RenderString() string {
 	return ""
 }
 
-// WithMessage sets custom message for the response.
+// WithMessage sets custom message for the response, named placeholders are rendered with the args.
 func (r *Response) WithMessage(message string) *Response {
-	r.Message = message
+	r.Message = ecodes.FormatMessage(message, r.args)
+	return r
+}
+
+// WithArgs sets the named arguments and renders the placeholders in the message.
+func (r *Response) WithArgs(args map[string]any) *Response {
+	r.args = lo.MapValues(args, func(v any, _ string) string { return fmt.Sprint(v) })
+	r.Message = ecodes.FormatMessage(r.Message, r.args)
 	return r
 }
 
@@ -159,11 +204,7 @@ func (r *Response) WrapCallers(depth ...int) *Response {
 	if len(depth) > 0 {
 		d = depth[0]
 	}
-	if r.callers == "[]" {
-		r.callers = strings.Replace(r.callers, "[", fmt.Sprintf(`["%s"`, debug.Caller(d)), 1)
-	} else {
-		r.callers = strings.Replace(r.callers, "[", fmt.Sprintf(`["%s", `, debug.Caller(d)), 1)
-	}
+	r.callers = status.PrependCaller(r.callers, debug.Caller(d))
 	return r
 }
 
@@ -183,10 +224,25 @@ func (r *Response) GetError() error {
 }
 
 // GetCallers return the callers of the response.
-func (r *Response) GetCallers() string {
+func (r *Response) GetCallers() [][]string {
 	return r.callers
 }
 
+// GetArgs return the message arguments of the response.
+func (r *Response) GetArgs() map[string]string {
+	return r.args
+}
+
+// GetOrigin return the service that originated the error of the response.
+func (r *Response) GetOrigin() string {
+	return r.origin
+}
+
+// GetHopCount return the number of services the error of the response passed through.
+func (r *Response) GetHopCount() int {
+	return r.hopCount
+}
+
 // GetLevel return the level of the response.
 func (r *Response) GetLevel() log.Level {
 	return r.level
@@ -19,9 +19,11 @@ import (
 	"github.com/go-kratos/kratos/v2/transport"
 	thttp "github.com/go-kratos/kratos/v2/transport/http"
 	"github.com/yearm/kratos-pkg/ecodes"
+	"github.com/yearm/kratos-pkg/errors"
 	"github.com/yearm/kratos-pkg/logger"
 	"github.com/yearm/kratos-pkg/utils/bytesconv"
 	"github.com/yearm/kratos-pkg/utils/gjson"
+	"github.com/yearm/kratos-pkg/xgrpc/status"
 	"github.com/yearm/kratos-pkg/xhttp/api"
 )
 
@@ -107,7 +109,10 @@ func Recovery() middleware.Middleware {
 					})
 					log.Context(ctx).Error(errInfo)
 					if ginCtx, ok := FromGinContext(ctx); ok {
-						r := api.NewError(ctx, ecodes.InternalServerError, fmt.Errorf(errString)).WithHTTPCode(http.StatusInternalServerError)
+						info := errors.RecoveredCode(e)
+						r := api.NewError(ctx, info.Code, fmt.Errorf(errString)).
+							WithCodeInfo(info).
+							WithHTTPCode(http.StatusInternalServerError)
 						RenderWithAbort(ginCtx, r)
 						return
 					}
@@ -171,7 +176,10 @@ func Log(logValuerMap ...map[string]LogValuer) middleware.Middleware {
 			reply, err = handler(ctx, req)
 
 			level := log.LevelInfo
-			var responseLog logger.ResponseLog
+			var (
+				responseLog logger.ResponseLog
+				fields      map[string]any
+			)
 			if ginCtx, ok := FromGinContext(ctx); ok {
 				apiResponse, _ := ginCtx.Get(responseKey)
 				if v, ok := apiResponse.(*api.Response); ok {
@@ -187,21 +195,30 @@ func Log(logValuerMap ...map[string]LogValuer) middleware.Middleware {
 							return errString
 						}()
 						responseLog.ErrorDetail = &logger.ErrorDetailLog{
-							Code:    uint32(v.Code),
-							Message: v.Message,
-							Level:   strings.ToLower(v.GetLevel().String()),
-							Callers: v.GetCallers(),
+							Code:     uint32(v.Code),
+							Message:  v.Message,
+							Level:    strings.ToLower(v.GetLevel().String()),
+							Severity: logger.SeverityValue(v.Code.Severity()),
+							Callers:  v.GetCallers(),
+							Args:     v.GetArgs(),
+							Origin:   v.GetOrigin(),
+							Hops:     v.GetHopCount(),
+						}
+						if level >= log.LevelError {
+							responseLog.Stack = errors.StackTrace(v.GetError())
 						}
+						fields = status.Fields(v.GetError())
 					}
 				}
 			}
 			responseLog.Latency = time.Since(startTime).Milliseconds()
 
-			log.Context(ctx).Log(level,
+			keyvals := []any{
 				log.DefaultMessageKey, "",
 				logger.RequestKey, requestLog,
 				logger.ResponseKey, responseLog,
-			)
+			}
+			log.Context(ctx).Log(level, append(keyvals, logger.FieldKeyvals(fields)...)...)
 			return
 		}
 	}